@@ -0,0 +1,216 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/converter"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
+)
+
+// Phases of a step within its test.
+const (
+	PhaseStep      = "step"       // It block
+	PhaseSetup     = "setup"      // BeforeEach
+	PhaseCleanup   = "cleanup"    // DeferCleanup of BeforeEach
+	PhaseBeforeAll = "before-all" // BeforeAll
+	PhaseAfterAll  = "after-all"  // DeferCleanup of BeforeAll
+)
+
+// Report lists every command the generated tests would run.
+type Report struct {
+	Steps []Step `json:"steps"`
+}
+
+// Step is a command of the generated tests as it will run.
+type Step struct {
+	File       string    `json:"file"`
+	Line       int       `json:"line"`
+	Describe   string    `json:"describe"`
+	Test       string    `json:"test"`
+	Phase      string    `json:"phase"`
+	Name       string    `json:"name"`
+	Command    string    `json:"command"`
+	Mode       string    `json:"mode"` // direct, shell or session
+	Argv       []string  `json:"argv"`
+	Binaries   []string  `json:"binaries"`
+	Env        []string  `json:"env,omitempty"`
+	Dir        string    `json:"dir,omitempty"`
+	Background bool      `json:"background,omitempty"`
+	Findings   []Finding `json:"policy_findings,omitempty"`
+}
+
+// Finding is a policy rule that matched a command of the step.
+type Finding struct {
+	Rule     string `json:"rule"`
+	Action   string `json:"action"`
+	Command  string `json:"command"`
+	Message  string `json:"message,omitempty"`
+	Override string `json:"override,omitempty"` // allow-blocked justification of a bypassed deny rule
+}
+
+// NewReport builds the report of specs in their order, each spec's steps
+// grouped by phase, from before-all to after-all. cmdCfg gives the shell of
+// shell and session steps.
+func NewReport(specs []domain.TestSpec, cmdCfg *config.CommandConfig) *Report {
+	report := &Report{Steps: []Step{}}
+	for _, spec := range specs {
+		phases := []struct {
+			name  string
+			steps []domain.TestStep
+		}{
+			{PhaseBeforeAll, spec.BeforeAllSteps},
+			{PhaseSetup, spec.SetupSteps},
+			{PhaseStep, spec.Steps},
+			{PhaseCleanup, spec.CleanupSteps},
+			{PhaseAfterAll, spec.AfterAllSteps},
+		}
+		for _, phase := range phases {
+			for _, step := range phase.steps {
+				mode, argv := converter.StepExecution(step, cmdCfg)
+				file := step.SourceFile
+				if file == "" {
+					file = spec.SourceFile
+				}
+				report.Steps = append(report.Steps, Step{
+					File:       file,
+					Line:       step.LineNumber,
+					Describe:   spec.DescribeBlock,
+					Test:       spec.TestName,
+					Phase:      phase.name,
+					Name:       step.Name,
+					Command:    strings.TrimSpace(step.Command),
+					Mode:       mode,
+					Argv:       argv,
+					Binaries:   nonNil(converter.CommandBinaries(step.Command)),
+					Env:        step.Env,
+					Dir:        step.Dir,
+					Background: step.Background,
+					Findings:   findings(step.PolicyFindings),
+				})
+			}
+		}
+	}
+	return report
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(r)
+}
+
+// WriteMarkdown writes the report as a Markdown document for review, one
+// section per source file.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# DocSyncer command audit\n\n")
+	fmt.Fprintf(&b, "%d command(s), %d policy override(s), %d denied command(s).\n", len(r.Steps), r.overrides(), r.denied())
+
+	for i, s := range r.Steps {
+		if i == 0 || s.File != r.Steps[i-1].File {
+			fmt.Fprintf(&b, "\n## %s\n", s.File)
+		}
+		fmt.Fprintf(&b, "\n### %s:%d — %s\n\n", s.File, s.Line, s.Name)
+		fmt.Fprintf(&b, "- Test: %s / %s (%s)\n", s.Describe, s.Test, s.Phase)
+		mode := s.Mode
+		if s.Background {
+			mode += ", background"
+		}
+		fmt.Fprintf(&b, "- Mode: %s\n", mode)
+		fmt.Fprintf(&b, "- Binaries: %s\n", codeList(s.Binaries))
+		if len(s.Env) > 0 {
+			fmt.Fprintf(&b, "- Env: %s\n", codeList(s.Env))
+		}
+		if s.Dir != "" {
+			fmt.Fprintf(&b, "- Workdir: `%s`\n", s.Dir)
+		}
+		for _, f := range s.Findings {
+			switch {
+			case f.Override != "":
+				fmt.Fprintf(&b, "- **Override** of %s rule `%s` on `%s`: %s\n", f.Action, f.Rule, f.Command, f.Override)
+			case f.Action == converter.ActionDeny:
+				fmt.Fprintf(&b, "- **Denied** by rule `%s` on `%s`: %s\n", f.Rule, f.Command, f.Message)
+			default:
+				fmt.Fprintf(&b, "- Policy %s rule `%s` on `%s`: %s\n", f.Action, f.Rule, f.Command, f.Message)
+			}
+		}
+		fence := codeFence(s.Command)
+		fmt.Fprintf(&b, "\n%ssh\n%s\n%s\n", fence, s.Command, fence)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// overrides counts the deny rules bypassed with allow-blocked.
+func (r *Report) overrides() int {
+	n := 0
+	for _, s := range r.Steps {
+		for _, f := range s.Findings {
+			if f.Override != "" {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// denied counts the commands denied by the policy without an override.
+func (r *Report) denied() int {
+	n := 0
+	for _, s := range r.Steps {
+		for _, f := range s.Findings {
+			if f.Action == converter.ActionDeny && f.Override == "" {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// codeList formats items as comma-separated inline code.
+func codeList(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = "`" + item + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// codeFence returns a backtick fence longer than any backtick run in content.
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for _, c := range content {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+func findings(policy []domain.PolicyFinding) []Finding {
+	var out []Finding
+	for _, f := range policy {
+		out = append(out, Finding{Rule: f.Rule, Action: f.Action, Command: f.Command, Message: f.Message, Override: f.Override})
+	}
+	return out
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
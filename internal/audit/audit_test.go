@@ -0,0 +1,108 @@
+package audit_test
+
+import (
+	"bytes"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/audit"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
+)
+
+var _ = Describe("Audit report", func() {
+	var (
+		cmdCfg *config.CommandConfig
+		specs  []domain.TestSpec
+	)
+
+	BeforeEach(func() {
+		cmdCfg = &config.DefaultConfig().Commands
+		specs = []domain.TestSpec{{
+			SourceFile:    "docs/install.md",
+			TestName:      "install",
+			DescribeBlock: "Install",
+			SetupSteps:    []domain.TestStep{{Name: "login", Command: "oc login", LineNumber: 3, SourceFile: "docs/partials/login.md"}},
+			Steps: []domain.TestStep{
+				{Name: "list", Command: "kubectl get pods -n demo", LineNumber: 8, Env: []string{"KUBECONFIG=/tmp/kc"}, Dir: "deploy"},
+				{Name: "pipe", Command: "kubectl get pods | grep web", LineNumber: 12},
+				{Name: "vars", Command: "echo ${POD}", LineNumber: 16, UsesVars: []string{"POD"}},
+				{Name: "session", Command: "cd /tmp", LineNumber: 20, InSession: true},
+				{Name: "wipe", Command: "sudo rm -rf /", LineNumber: 24, PolicyFindings: []domain.PolicyFinding{
+					{Rule: "rm-root", Action: "deny", Command: "rm -rf /", Override: "throwaway VM"},
+				}},
+			},
+		}}
+	})
+
+	It("lists the steps of each phase with how they run", func() {
+		report := audit.NewReport(specs, cmdCfg)
+		Expect(report.Steps).To(HaveLen(6))
+
+		setup := report.Steps[0]
+		Expect(setup.Phase).To(Equal(audit.PhaseSetup))
+		Expect(setup.File).To(Equal("docs/partials/login.md"))
+		Expect(setup.Line).To(Equal(3))
+
+		list := report.Steps[1]
+		Expect(list.File).To(Equal("docs/install.md"))
+		Expect(list.Phase).To(Equal(audit.PhaseStep))
+		Expect(list.Mode).To(Equal("direct"))
+		Expect(list.Argv).To(Equal([]string{"kubectl", "get", "pods", "-n", "demo"}))
+		Expect(list.Env).To(Equal([]string{"KUBECONFIG=/tmp/kc"}))
+		Expect(list.Dir).To(Equal("deploy"))
+
+		pipe := report.Steps[2]
+		Expect(pipe.Mode).To(Equal("shell"))
+		Expect(pipe.Argv).To(Equal([]string{"/bin/sh", "-c", "kubectl get pods | grep web"}))
+		Expect(pipe.Binaries).To(Equal([]string{"kubectl", "grep"}))
+
+		Expect(report.Steps[3].Mode).To(Equal("shell"))
+		Expect(report.Steps[4].Mode).To(Equal("session"))
+
+		wipe := report.Steps[5]
+		Expect(wipe.Binaries).To(Equal([]string{"sudo", "rm"}))
+		Expect(wipe.Findings).To(ConsistOf(audit.Finding{
+			Rule: "rm-root", Action: "deny", Command: "rm -rf /", Override: "throwaway VM",
+		}))
+	})
+
+	It("writes the report as JSON", func() {
+		var buf bytes.Buffer
+		Expect(audit.NewReport(specs, cmdCfg).WriteJSON(&buf)).To(Succeed())
+
+		var decoded struct {
+			Steps []map[string]any `json:"steps"`
+		}
+		Expect(json.Unmarshal(buf.Bytes(), &decoded)).To(Succeed())
+		Expect(decoded.Steps).To(HaveLen(6))
+		Expect(decoded.Steps[2]).To(HaveKeyWithValue("command", "kubectl get pods | grep web"))
+		Expect(decoded.Steps[5]).To(HaveKey("policy_findings"))
+	})
+
+	It("writes the report as Markdown", func() {
+		specs[0].Steps[1].PolicyFindings = []domain.PolicyFinding{
+			{Rule: "no-grep", Action: "deny", Command: "grep web", Message: "use jq"},
+		}
+		var buf bytes.Buffer
+		Expect(audit.NewReport(specs, cmdCfg).WriteMarkdown(&buf)).To(Succeed())
+
+		md := buf.String()
+		Expect(md).To(ContainSubstring("6 command(s), 1 policy override(s), 1 denied command(s)."))
+		Expect(md).To(ContainSubstring("## docs/install.md"))
+		Expect(md).To(ContainSubstring("### docs/install.md:8 — list"))
+		Expect(md).To(ContainSubstring("- Workdir: `deploy`"))
+		Expect(md).To(ContainSubstring("- **Override** of deny rule `rm-root` on `rm -rf /`: throwaway VM"))
+		Expect(md).To(ContainSubstring("- **Denied** by rule `no-grep` on `grep web`: use jq"))
+		Expect(md).To(ContainSubstring("```sh\nkubectl get pods | grep web\n```"))
+	})
+
+	It("uses a longer fence for commands with backticks", func() {
+		specs[0].Steps = []domain.TestStep{{Name: "sub", Command: "echo ```x```", LineNumber: 1}}
+		var buf bytes.Buffer
+		Expect(audit.NewReport(specs, cmdCfg).WriteMarkdown(&buf)).To(Succeed())
+		Expect(buf.String()).To(ContainSubstring("````sh\necho ```x```\n````"))
+	})
+})
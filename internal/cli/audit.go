@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/audit"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditJSON     string
+	auditMarkdown string
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Report every command the generated tests would run",
+	Long: `Scans, parses and converts the documentation like generate, without writing
+test files, and reports every step's command: how it runs (directly, through
+the shell or in a session), the binaries it invokes, its environment and
+working directory, its source line, and the policy rules and overrides that
+apply to it. Commands the policy denies are reported rather than stopping the
+audit.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		if err := config.Validate(cfg); err != nil {
+			return fmt.Errorf("config validation failed: %w", err)
+		}
+
+		// Every denied command is reported, not only the first
+		gen, err := newGenerator(cfg, true)
+		if err != nil {
+			return err
+		}
+		specs, err := gen.Specs(cfg)
+		if err != nil {
+			return err
+		}
+
+		report := audit.NewReport(specs, &cfg.Commands)
+		if err := writeReport(auditJSON, report.WriteJSON); err != nil {
+			return err
+		}
+		if err := writeReport(auditMarkdown, report.WriteMarkdown); err != nil {
+			return err
+		}
+		log.Info("Audit complete", "commands", len(report.Steps), "json", auditJSON, "markdown", auditMarkdown)
+		return nil
+	},
+}
+
+func init() {
+	auditCmd.Flags().StringVar(&auditJSON, "json", "docsyncer-audit.json", "JSON report path (\"-\" for stdout, empty to skip)")
+	auditCmd.Flags().StringVar(&auditMarkdown, "markdown", "docsyncer-audit.md", "Markdown report path (\"-\" for stdout, empty to skip)")
+	rootCmd.AddCommand(auditCmd)
+}
+
+// writeReport writes a report with write to path, or to stdout when path is "-".
+// An empty path skips the report.
+func writeReport(path string, write func(io.Writer) error) error {
+	switch path {
+	case "":
+		return nil
+	case "-":
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create audit report: %w", err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write audit report %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var force bool
+
 var generateCmd = &cobra.Command{
 	Use:   "generate",
 	Short: "Generate E2E test files from documentation",
@@ -29,6 +31,7 @@ var generateCmd = &cobra.Command{
 		if dryRun {
 			cfg.DryRun = true
 		}
+		cfg.Force = force
 
 		log.Info("Configuration loaded successfully")
 		log.Info("Scanning directories", "directories", cfg.Input.Directories)
@@ -39,11 +42,22 @@ var generateCmd = &cobra.Command{
 }
 
 func init() {
+	generateCmd.Flags().BoolVar(&force, "force", false, "overwrite generated files edited by hand")
 	rootCmd.AddCommand(generateCmd)
 }
 
 // runGenerate wires all components and runs the generator.
 func runGenerate(cfg *config.Config) error {
+	gen, err := newGenerator(cfg, false)
+	if err != nil {
+		return err
+	}
+	return gen.Generate(cfg)
+}
+
+// newGenerator wires the scanner, parsers, converter and template engine of
+// cfg. With collectDenied, denied commands are reported instead of failing.
+func newGenerator(cfg *config.Config, collectDenied bool) (*generator.DefaultGenerator, error) {
 	// Create scanner
 	recursive := true
 	if cfg.Input.Recursive != nil {
@@ -54,18 +68,24 @@ func runGenerate(cfg *config.Config) error {
 	// Create parser registry
 	registry := parser.NewRegistry()
 	registry.Register(parser.NewMarkdownParser())
+	registry.Register(parser.NewMDXParser())
 	registry.Register(parser.NewAsciiDocParser())
+	registry.Register(parser.NewRSTParser())
 
 	// Create converter
-	conv := converter.NewConverter(&cfg.Commands)
+	conv, err := converter.NewConverter(&cfg.Commands)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commands settings in %s: %w", cfgFile, err)
+	}
+	if collectDenied {
+		conv.CollectDenied()
+	}
 
 	// Create template engine
 	engine, err := tmpl.NewEngine(cfg.Templates.Directory, cfg.Templates.Default, cfg.Output.BuildTag)
 	if err != nil {
-		return fmt.Errorf("failed to create template engine: %w", err)
+		return nil, fmt.Errorf("failed to create template engine: %w", err)
 	}
 
-	// Create and run generator
-	gen := generator.NewGenerator(s, registry, conv, engine, log)
-	return gen.Generate(cfg)
+	return generator.NewGenerator(s, registry, conv, engine, log), nil
 }
@@ -4,6 +4,7 @@ import (
 	"log/slog"
 	"os"
 
+	"github.com/fjglira/GoE2E-DocSyncer/internal/generator"
 	"github.com/spf13/cobra"
 )
 
@@ -32,6 +33,7 @@ Everything is driven by a YAML configuration file (docsyncer.yaml).`,
 }
 
 func init() {
+	rootCmd.Version = generator.Version
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "docsyncer.yaml", "config file path")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "enable verbose output")
 	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "parse and convert but don't write files")
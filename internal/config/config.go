@@ -17,6 +17,9 @@ type Config struct {
 	Commands  CommandConfig  `yaml:"commands"`
 	Logging   LoggingConfig  `yaml:"logging"`
 	DryRun    bool           `yaml:"dry_run"`
+	// Force overwrites generated files edited by hand. Only generate --force
+	// sets it, so that a config file cannot turn the protection off for good.
+	Force bool `yaml:"-"`
 }
 
 type InputConfig struct {
@@ -33,6 +36,12 @@ type TagConfig struct {
 	StepStart  TestMarkerConfig    `yaml:"step_start"`
 	StepEnd    TestMarkerConfig    `yaml:"step_end"`
 	Attributes map[string][]string `yaml:"attributes"`
+	// OutputTags identify companion blocks holding the expected output of the
+	// step block right before them.
+	OutputTags []string `yaml:"output_tags"`
+	// TabValues lists preferred MDX <TabItem value="..."> variants in priority order.
+	// Within each <Tabs> group only one item becomes part of the test.
+	TabValues []string `yaml:"tab_values"`
 }
 
 type TestMarkerConfig struct {
@@ -57,11 +66,68 @@ type TemplateConfig struct {
 }
 
 type CommandConfig struct {
-	DefaultTimeout          string   `yaml:"default_timeout"`
-	DefaultExpectedExitCode int      `yaml:"default_expected_exit_code"`
-	BlockedPatterns         []string `yaml:"blocked_patterns"`
-	Shell                   string   `yaml:"shell"`
-	ShellFlag               string   `yaml:"shell_flag"`
+	DefaultTimeout          string `yaml:"default_timeout"`
+	DefaultExpectedExitCode int    `yaml:"default_expected_exit_code"`
+	// BlockedPatterns deny commands that have the command name, flags,
+	// operands and redirects of one of the patterns. Prefer Policy rules.
+	BlockedPatterns []string     `yaml:"blocked_patterns"`
+	Policy          PolicyConfig `yaml:"policy"`
+	// AllowOverrides lets a block bypass named deny rules with the
+	// allow-blocked="RULE: reason" attribute.
+	AllowOverrides bool   `yaml:"allow_overrides"`
+	Shell          string `yaml:"shell"`
+	ShellFlag      string `yaml:"shell_flag"`
+	// ConsolePrompt is the regex matching the prompt of command lines in
+	// console session blocks (blocks with the console attribute set).
+	ConsolePrompt string `yaml:"console_prompt"`
+	// OutputWhitespace controls whitespace normalization in output assertions:
+	// "none", "trim" (default) or "collapse".
+	OutputWhitespace string `yaml:"output_whitespace"`
+	// Session selects how the steps of an It block run: "isolated" (default),
+	// one process per step, or "persistent", one shell fed every step so that
+	// cd, export and shell functions carry over.
+	Session string `yaml:"session"`
+}
+
+// PolicyConfig decides which commands step blocks may run. Each simple command
+// of a block, including those in pipelines, substitutions, sh -c scripts and
+// behind wrappers such as sudo or env, is checked against the rules.
+type PolicyConfig struct {
+	// AllowedBinaries, when set, are the only commands allowed (globs on the
+	// command name, e.g. "kubectl" or "mkfs.*"), unless an allow rule matches.
+	AllowedBinaries []string          `yaml:"allowed_binaries"`
+	Rules           []PolicyRule      `yaml:"rules"`
+	Directories     []DirectoryPolicy `yaml:"directories"`
+}
+
+// PolicyRule matches a command when all of its set conditions hold. Rules are
+// checked in order: the first deny or allow rule that matches decides, while
+// warn rules report the command and go on.
+type PolicyRule struct {
+	Name   string `yaml:"name"`
+	Action string `yaml:"action"` // deny (default), warn or allow
+	// Command is a glob on the command name without its directory, e.g. "mkfs*".
+	Command string `yaml:"command"`
+	// Flags must all be present; "-r|-R|--recursive" lists alternatives.
+	// Combined short flags such as -rf count as -r and -f.
+	Flags []string `yaml:"flags"`
+	// Args match when any operand equals one of them, e.g. "/".
+	Args []string `yaml:"args"`
+	// Redirects match when the target of an output redirect matches one of
+	// these globs, e.g. "/dev/sd*".
+	Redirects []string `yaml:"redirects"`
+	// Regex matches the command text, with words separated by single spaces
+	// and redirects such as "> /dev/sda" at the end.
+	Regex   string `yaml:"regex"`
+	Message string `yaml:"message"`
+}
+
+// DirectoryPolicy applies to the documents under Path. Its rules are checked
+// before the global ones and its allow-list, when set, replaces the global one.
+type DirectoryPolicy struct {
+	Path            string       `yaml:"path"`
+	AllowedBinaries []string     `yaml:"allowed_binaries"`
+	Rules           []PolicyRule `yaml:"rules"`
 }
 
 type LoggingConfig struct {
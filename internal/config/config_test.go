@@ -8,6 +8,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/parser"
 )
 
 var _ = Describe("Config", func() {
@@ -50,6 +51,19 @@ var _ = Describe("Config", func() {
 	})
 
 	Describe("DefaultConfig", func() {
+		It("should include every extension a parser supports", func() {
+			include := config.DefaultConfig().Input.Include
+			parsers := []parser.Parser{parser.NewMarkdownParser(), parser.NewMDXParser(), parser.NewAsciiDocParser(), parser.NewRSTParser()}
+			for _, p := range parsers {
+				for _, ext := range p.SupportedExtensions() {
+					Expect(include).To(ContainElement(Satisfy(func(glob string) bool {
+						ok, _ := filepath.Match(glob, "guide"+ext)
+						return ok
+					})), "no default include glob matches %s files", ext)
+				}
+			}
+		})
+
 		It("should return config with sensible defaults", func() {
 			cfg := config.DefaultConfig()
 			Expect(cfg).ToNot(BeNil())
@@ -111,5 +125,42 @@ var _ = Describe("Config", func() {
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("logging.level"))
 		})
+
+		It("should fail for an invalid console prompt regex", func() {
+			cfg := config.DefaultConfig()
+			cfg.Commands.ConsolePrompt = "^[$"
+			err := config.Validate(cfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("commands.console_prompt"))
+		})
+
+		It("should fail for an unknown session mode", func() {
+			cfg := config.DefaultConfig()
+			cfg.Commands.Session = "shared"
+			err := config.Validate(cfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("commands.session"))
+		})
+
+		It("should accept the default command policy", func() {
+			Expect(config.Validate(config.DefaultConfig())).To(Succeed())
+		})
+
+		It("should fail for invalid command policy rules", func() {
+			cfg := config.DefaultConfig()
+			cfg.Commands.Policy.Rules = []config.PolicyRule{
+				{Name: "bad-action", Action: "block", Command: "rm"},
+				{Name: "no-matcher", Flags: []string{"-r"}},
+				{Name: "bad-regex", Regex: "(["},
+			}
+			cfg.Commands.Policy.Directories = []config.DirectoryPolicy{{AllowedBinaries: []string{"["}}}
+			err := config.Validate(cfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("commands.policy.rules[0] (bad-action): action must be one of"))
+			Expect(err.Error()).To(ContainSubstring("commands.policy.rules[1] (no-matcher): set command, redirects or regex"))
+			Expect(err.Error()).To(ContainSubstring("commands.policy.rules[2] (bad-regex): regex must be a valid"))
+			Expect(err.Error()).To(ContainSubstring("commands.policy.directories[0].path must not be empty"))
+			Expect(err.Error()).To(ContainSubstring("commands.policy.directories[0].allowed_binaries"))
+		})
 	})
 })
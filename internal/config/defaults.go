@@ -6,17 +6,19 @@ func DefaultConfig() *Config {
 	return &Config{
 		Input: InputConfig{
 			Directories: []string{"docs"},
-			Include:     []string{"*.md", "*.adoc"},
+			Include:     []string{"*.md", "*.markdown", "*.mdx", "*.adoc", "*.asciidoc", "*.rst", "*.rest"},
 			Exclude:     []string{"vendor/**", "node_modules/**"},
 			Recursive:   &recursive,
 		},
 		Tags: TagConfig{
-			StepTags: []string{"go-e2e-step"},
+			StepTags:   []string{"go-e2e-step"},
+			OutputTags: []string{"go-e2e-output"},
 			TestStart: TestMarkerConfig{
 				CommentMarkers: []string{
 					"<!-- test-start:",
 					"// test-start:",
 					"# test-start:",
+					".. test-start:",
 				},
 				AttributeKey: "init",
 			},
@@ -25,6 +27,7 @@ func DefaultConfig() *Config {
 					"<!-- test-end",
 					"// test-end",
 					"# test-end",
+					".. test-end",
 				},
 				AttributeKey: "end",
 			},
@@ -33,6 +36,7 @@ func DefaultConfig() *Config {
 					"<!-- test-step-start:",
 					"// test-step-start:",
 					"# test-step-start:",
+					".. test-step-start:",
 				},
 			},
 			StepEnd: TestMarkerConfig{
@@ -40,6 +44,7 @@ func DefaultConfig() *Config {
 					"<!-- test-step-end",
 					"// test-step-end",
 					"# test-step-end",
+					".. test-step-end",
 				},
 			},
 			Attributes: map[string][]string{
@@ -49,9 +54,31 @@ func DefaultConfig() *Config {
 				"describe":          {"describe"},
 				"context":           {"context"},
 				"skip_on_failure":   {"skip-on-failure"},
+				"continue_on_error": {"continue-on-error"},
 				"template":         {"template"},
 				"retry":            {"retry", "retries", "retry-count"},
 				"retry_interval":   {"retry-interval", "retry-delay"},
+				"eventually":       {"eventually"},
+				"consistently":     {"consistently"},
+				"poll":             {"poll", "poll-interval"},
+				"labels":           {"labels"},
+				"skip":             {"skip"},
+				"console":          {"console"},
+				"match":            {"match"},
+				"expect_json":      {"expect-json"},
+				"expect_jsonpath":  {"expect-jsonpath"},
+				"expect_yaml":      {"expect-yaml"},
+				"capture":          {"capture"},
+				"capture_regex":    {"capture-regex"},
+				"capture_jsonpath": {"capture-jsonpath"},
+				"session":          {"session"},
+				"env":              {"env"},
+				"workdir":          {"workdir", "dir"},
+				"stdin":            {"stdin"},
+				"phase":            {"phase"},
+				"background":       {"background"},
+				"ready_when":       {"ready-when"},
+				"allow_blocked":    {"allow-blocked"},
 			},
 		},
 		Output: OutputConfig{
@@ -70,15 +97,22 @@ func DefaultConfig() *Config {
 		Commands: CommandConfig{
 			DefaultTimeout:          "30s",
 			DefaultExpectedExitCode: 0,
-			BlockedPatterns: []string{
-				"rm -rf /",
-				"mkfs",
-				"dd if=",
-				"format c:",
-				"> /dev/sd",
+			Policy: PolicyConfig{
+				Rules: []PolicyRule{
+					{Name: "rm-root", Command: "rm", Flags: []string{"-r|-R|--recursive"}, Args: []string{"/", "/*"},
+						Message: "recursively removes the root filesystem"},
+					{Name: "mkfs", Command: "mkfs*", Message: "formats a filesystem"},
+					{Name: "dd-device", Command: "dd", Regex: `\bof=/dev/`, Message: "writes a raw device"},
+					{Name: "format-drive", Command: "format", Args: []string{"c:", "C:"}, Message: "formats a drive"},
+					{Name: "write-disk", Redirects: []string{"/dev/sd*", "/dev/hd*", "/dev/nvme*", "/dev/vd*"}, Message: "writes a raw disk"},
+				},
 			},
-			Shell:     "/bin/sh",
-			ShellFlag: "-c",
+			AllowOverrides:   true,
+			Shell:            "/bin/sh",
+			ShellFlag:        "-c",
+			ConsolePrompt:    `^\s*\$\s+`,
+			OutputWhitespace: "trim",
+			Session:          "isolated",
 		},
 		Logging: LoggingConfig{
 			Level: "info",
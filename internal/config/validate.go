@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"path"
+	"regexp"
 	"strings"
 
 	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
@@ -38,6 +40,33 @@ func Validate(cfg *Config) error {
 		errs = append(errs, fmt.Sprintf("output.file_suffix must end with .go (got %q) — use e.g. \"_test.go\"", cfg.Output.FileSuffix))
 	}
 
+	// Commands validation
+	if cfg.Commands.ConsolePrompt != "" {
+		if _, err := regexp.Compile(cfg.Commands.ConsolePrompt); err != nil {
+			errs = append(errs, fmt.Sprintf("commands.console_prompt must be a valid regular expression (got %q): %v", cfg.Commands.ConsolePrompt, err))
+		}
+	}
+	switch cfg.Commands.OutputWhitespace {
+	case "", "none", "trim", "collapse":
+	default:
+		errs = append(errs, fmt.Sprintf("commands.output_whitespace must be one of: none, trim, collapse (got %q)", cfg.Commands.OutputWhitespace))
+	}
+	switch cfg.Commands.Session {
+	case "", "isolated", "persistent":
+	default:
+		errs = append(errs, fmt.Sprintf("commands.session must be one of: isolated, persistent (got %q)", cfg.Commands.Session))
+	}
+	errs = append(errs, validateGlobs("commands.policy.allowed_binaries", cfg.Commands.Policy.AllowedBinaries)...)
+	errs = append(errs, validateRules("commands.policy.rules", cfg.Commands.Policy.Rules)...)
+	for i, dir := range cfg.Commands.Policy.Directories {
+		field := fmt.Sprintf("commands.policy.directories[%d]", i)
+		if dir.Path == "" {
+			errs = append(errs, field+".path must not be empty — set the documentation directory the policy applies to")
+		}
+		errs = append(errs, validateGlobs(field+".allowed_binaries", dir.AllowedBinaries)...)
+		errs = append(errs, validateRules(field+".rules", dir.Rules)...)
+	}
+
 	// Validate logging level
 	if cfg.Logging.Level != "" {
 		validLevels := map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
@@ -55,3 +84,45 @@ func Validate(cfg *Config) error {
 
 	return nil
 }
+
+// validateRules checks the actions, matchers and regexes of policy rules.
+func validateRules(field string, rules []PolicyRule) []string {
+	var errs []string
+	for i, r := range rules {
+		name := fmt.Sprintf("%s[%d]", field, i)
+		if r.Name != "" {
+			name += fmt.Sprintf(" (%s)", r.Name)
+		}
+		switch r.Action {
+		case "", "deny", "warn", "allow":
+		default:
+			errs = append(errs, fmt.Sprintf("%s: action must be one of: deny, warn, allow (got %q)", name, r.Action))
+		}
+		if r.Command == "" && r.Regex == "" && len(r.Redirects) == 0 {
+			errs = append(errs, fmt.Sprintf("%s: set command, redirects or regex to select the commands the rule applies to", name))
+		}
+		if _, err := path.Match(r.Command, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: command must be a valid glob (got %q): %v", name, r.Command, err))
+		}
+		for _, g := range r.Redirects {
+			if _, err := path.Match(g, ""); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: redirects must hold valid globs (got %q): %v", name, g, err))
+			}
+		}
+		if _, err := regexp.Compile(r.Regex); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: regex must be a valid regular expression (got %q): %v", name, r.Regex, err))
+		}
+	}
+	return errs
+}
+
+// validateGlobs checks the command name globs of an allow-list.
+func validateGlobs(field string, globs []string) []string {
+	var errs []string
+	for _, g := range globs {
+		if _, err := path.Match(g, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("%s must hold valid globs (got %q): %v", field, g, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,156 @@
+package converter
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
+)
+
+// readyPollInterval is the time between readiness checks of a background step.
+const readyPollInterval = "500ms"
+
+// Prefixes of the ready-when attribute; a value without prefix is a log regex.
+const (
+	readyPort = "port:" // port:8080 — localhost:8080 accepts TCP connections
+	readyTCP  = "tcp:"  // tcp:HOST:PORT — HOST:PORT accepts TCP connections
+	readyLog  = "log:"  // log:REGEX — the process output matches REGEX
+)
+
+// resolveBackground reads the background and ready-when attributes of a block
+// into step. A command ending with & is a background step too. Background steps
+// start a long-lived process, so they cannot retry, poll, capture or assert output.
+func resolveBackground(step *domain.TestStep, block domain.CodeBlock, tagCfg *config.TagConfig) error {
+	readyWhen := resolveAttribute(block.Attributes, tagCfg.Attributes["ready_when"])
+	background := isTrue(resolveAttribute(block.Attributes, tagCfg.Attributes["background"]))
+
+	if step.InSession {
+		if background || readyWhen != "" {
+			return fmt.Errorf("background and ready-when are not supported in a persistent session — end the command with & to run it as a job of the session's shell")
+		}
+		return nil
+	}
+	if command, ok := endsInBackground(step.Command); ok {
+		step.Command = command
+		background = true
+	}
+	if !background {
+		if readyWhen != "" {
+			return fmt.Errorf("ready-when needs background=true")
+		}
+		return nil
+	}
+
+	switch {
+	case step.RetryCount > 0 || isPolled(*step):
+		return fmt.Errorf("a background step cannot retry or poll — use ready-when to wait for it")
+	case step.CaptureVar != "" || len(step.StructuredAssertions) > 0:
+		return fmt.Errorf("a background step cannot capture or assert its output — use ready-when to wait for it")
+	}
+
+	if readyWhen != "" {
+		if timeout, err := time.ParseDuration(step.Timeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("ready-when needs a timeout to wait for the process, got timeout=%q", step.Timeout)
+		}
+		if _, _, err := parseReadyWhen(readyWhen); err != nil {
+			return err
+		}
+	}
+
+	step.Background = true
+	step.ReadyWhen = readyWhen
+	return nil
+}
+
+// parseReadyWhen splits a ready-when value into the address to dial, or else
+// the regex the process output must match.
+func parseReadyWhen(readyWhen string) (addr, logRegex string, err error) {
+	switch {
+	case strings.HasPrefix(readyWhen, readyPort):
+		port := strings.TrimPrefix(readyWhen, readyPort)
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return "", "", fmt.Errorf("invalid ready-when port %q", port)
+		}
+		return net.JoinHostPort("localhost", port), "", nil
+	case strings.HasPrefix(readyWhen, readyTCP):
+		addr := strings.TrimPrefix(readyWhen, readyTCP)
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return "", "", fmt.Errorf("invalid ready-when address %q — use tcp:HOST:PORT", addr)
+		}
+		return addr, "", nil
+	}
+
+	logRegex = strings.TrimPrefix(readyWhen, readyLog)
+	if _, err := regexp.Compile(logRegex); err != nil {
+		return "", "", fmt.Errorf("invalid ready-when regex %q: %v", logRegex, err)
+	}
+	return "", logRegex, nil
+}
+
+// generateBackgroundStep generates the code starting a background step in its
+// own process group, with its output collected in a buffer. DeferCleanup kills
+// the group when the node's cleanup runs (after the It block for steps and
+// setup, after all It blocks for before-all) and writes the output to
+// GinkgoWriter if the spec failed. With ready-when, the step then polls until
+// the process is ready, failing early if it exits.
+func generateBackgroundStep(step domain.TestStep, sh shellCommand, cmdCfg *config.CommandConfig) string {
+	args := sh.args
+	if args == nil {
+		args = []string{cmdCfg.Shell, cmdCfg.ShellFlag, sh.script}
+	}
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = fmt.Sprintf("%q", a)
+	}
+
+	lines := []string{
+		fmt.Sprintf("cmd := exec.Command(%s)", strings.Join(quoted, ", ")),
+		"cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}",
+		fmt.Sprintf("cmd.WaitDelay = %s", formatDuration(waitDelay)),
+	}
+	lines = append(lines, commandSetup(step)...)
+	goCode := fmt.Sprintf(`%s
+			bgOutput := gbytes.NewBuffer()
+			cmd.Stdout = bgOutput
+			cmd.Stderr = bgOutput
+			Expect(cmd.Start()).To(Succeed())
+			bgDone := make(chan struct{})
+			go func() {
+				cmd.Wait()
+				close(bgDone)
+			}()
+			DeferCleanup(func() {
+				syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+				<-bgDone
+				if CurrentSpecReport().Failed() {
+					GinkgoWriter.Printf("output of background step %%q:\n%%s\n", %q, bgOutput.Contents())
+				}
+			})`, strings.Join(lines, "\n\t\t\t"), step.Name)
+
+	if step.ReadyWhen == "" {
+		return goCode
+	}
+
+	addr, logRegex, _ := parseReadyWhen(step.ReadyWhen)
+	check := fmt.Sprintf(`g.Expect(string(bgOutput.Contents())).To(MatchRegexp(%q))`, logRegex)
+	if addr != "" {
+		check = fmt.Sprintf(`conn, err := net.DialTimeout("tcp", %q, time.Second)
+				g.Expect(err).ToNot(HaveOccurred())
+				conn.Close()`, addr)
+	}
+	return goCode + fmt.Sprintf(`
+			Eventually(ctx, func(g Gomega) {
+				select {
+				case <-bgDone:
+					StopTrying(fmt.Sprintf("background step exited before it was ready:\n%%s", bgOutput.Contents())).Now()
+				default:
+				}
+				%s
+			}).WithTimeout(%s).WithPolling(%s).Should(Succeed(), "waiting for ready-when %%s", %q)`,
+		check, formatDuration(step.Timeout), formatDuration(readyPollInterval), step.ReadyWhen)
+}
@@ -0,0 +1,127 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
+)
+
+var (
+	// varRefRe matches ${NAME} references in commands
+	varRefRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+	// varNameRe matches valid capture and environment variable names
+	varNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// captureNames collects the variable names captured by any block of a document.
+// Only these names are treated as captured variables when referenced as ${NAME};
+// other references are left to the shell environment.
+func captureNames(blocks []domain.CodeBlock, tagCfg *config.TagConfig) map[string]bool {
+	names := make(map[string]bool)
+	for _, block := range blocks {
+		if name := resolveAttribute(block.Attributes, tagCfg.Attributes["capture"]); name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// referencedVars returns the distinct captured variables referenced by command, in order.
+func referencedVars(command string, captured map[string]bool) []string {
+	var refs []string
+	seen := make(map[string]bool)
+	for _, m := range varRefRe.FindAllStringSubmatch(command, -1) {
+		if name := m[1]; captured[name] && !seen[name] {
+			seen[name] = true
+			refs = append(refs, name)
+		}
+	}
+	return refs
+}
+
+// resolveCapture reads the capture, capture-regex and capture-jsonpath
+// attributes of a block into step, validating them at generation time.
+func resolveCapture(step *domain.TestStep, block domain.CodeBlock, tagCfg *config.TagConfig) error {
+	name := resolveAttribute(block.Attributes, tagCfg.Attributes["capture"])
+	re := resolveAttribute(block.Attributes, tagCfg.Attributes["capture_regex"])
+	path := resolveAttribute(block.Attributes, tagCfg.Attributes["capture_jsonpath"])
+
+	if name == "" {
+		if re != "" || path != "" {
+			return fmt.Errorf("capture-regex and capture-jsonpath need a capture=NAME attribute")
+		}
+		return nil
+	}
+	if !varNameRe.MatchString(name) {
+		return fmt.Errorf("invalid capture variable name %q — use letters, digits and underscores", name)
+	}
+	if re != "" && path != "" {
+		return fmt.Errorf("capture %s: use either capture-regex or capture-jsonpath, not both", name)
+	}
+	if re != "" {
+		if _, err := regexp.Compile(re); err != nil {
+			return fmt.Errorf("capture %s: invalid capture-regex %q: %v", name, re, err)
+		}
+	}
+	if path != "" {
+		e, err := parseJSONPathExpr(path)
+		if err != nil {
+			return fmt.Errorf("capture %s: %w", name, err)
+		}
+		if e.op != "" {
+			return fmt.Errorf("capture %s: capture-jsonpath %q must be a path without comparison", name, path)
+		}
+	}
+
+	step.CaptureVar = name
+	step.CaptureRegex = re
+	step.CaptureJSONPath = path
+	return nil
+}
+
+// captureCode generates Go code storing the step output held in the []byte
+// variable outputVar into the per-It vars map. The whole trimmed output is
+// stored, or the first regex group (else the whole match), or the JSONPath value.
+func captureCode(step domain.TestStep, outputVar string) string {
+	if step.CaptureVar == "" {
+		return ""
+	}
+
+	switch {
+	case step.CaptureRegex != "":
+		group := 0
+		if regexp.MustCompile(step.CaptureRegex).NumSubexp() > 0 {
+			group = 1
+		}
+		return fmt.Sprintf(`{
+				m := regexp.MustCompile(%q).FindStringSubmatch(string(%s))
+				Expect(m).ToNot(BeNil(), "capture %%s: %%s does not match the output:\n%%s", %q, %q, string(%s))
+				vars[%q] = strings.TrimSpace(m[%d])
+			}`, step.CaptureRegex, outputVar, step.CaptureVar, step.CaptureRegex, outputVar, step.CaptureVar, group)
+
+	case step.CaptureJSONPath != "":
+		e, err := parseJSONPathExpr(step.CaptureJSONPath)
+		if err != nil {
+			return ""
+		}
+		return fmt.Sprintf(`{
+				%s
+				Expect(val).ToNot(BeNil(), "capture %%s: %%s not found", %q, %q)
+				vars[%q] = strings.TrimSpace(fmt.Sprint(val))
+			}`, lookupCode("json", e.path, outputVar, step.CaptureJSONPath), step.CaptureVar, step.CaptureJSONPath, step.CaptureVar)
+	}
+
+	return fmt.Sprintf("vars[%q] = strings.TrimSpace(string(%s))", step.CaptureVar, outputVar)
+}
+
+// varEnvEntries generates the environment entries passing captured variables
+// to a command, where the shell expands the ${NAME} references.
+func varEnvEntries(vars []string) []string {
+	entries := make([]string, len(vars))
+	for i, v := range vars {
+		entries[i] = fmt.Sprintf(`%q+vars[%q]`, v+"=", v)
+	}
+	return entries
+}
@@ -2,94 +2,212 @@ package converter
 
 import (
 	"fmt"
-	"regexp"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
 )
 
-// GenerateGoCode converts a shell command string into Go code using os/exec.
-func GenerateGoCode(command string, expectedExit int, timeout string, retryCount int, retryInterval string, cmdCfg *config.CommandConfig) string {
-	command = strings.TrimSpace(command)
-	lines := strings.Split(command, "\n")
-
-	// Multi-line commands: preserve newlines for heredocs, join with && otherwise
-	if len(lines) > 1 {
-		if containsHeredoc(command) {
-			// Heredoc content must preserve newlines (YAML is indentation-sensitive)
-			var trimmed []string
-			for _, l := range lines {
-				l = strings.TrimRight(l, " \t")
-				if l != "" {
-					trimmed = append(trimmed, l)
-				}
-			}
-			command = strings.Join(trimmed, "\n")
-		} else {
-			var trimmed []string
-			for _, l := range lines {
-				l = strings.TrimSpace(l)
-				if l != "" {
-					trimmed = append(trimmed, l)
-				}
-			}
-			command = strings.Join(trimmed, " && ")
-		}
+// GenerateGoCode converts a step's shell command into Go code using os/exec.
+// The step supplies the expected exit code, timeout, retry settings and the
+// optional expected output assertion.
+func GenerateGoCode(step domain.TestStep, cmdCfg *config.CommandConfig) string {
+	sh := stepCommand(step)
+	command := sh.script
+	if command == "" {
+		command = strings.TrimSpace(step.Command)
+	}
+
+	// Steps of a persistent session run in the It block's shell
+	if step.InSession {
+		return wrapWithFailureMode(generateSessionStep(step, command, cmdCfg), step)
+	}
+
+	// Background steps start the process and wait until it is ready, if asked
+	if step.Background {
+		return wrapWithFailureMode(generateBackgroundStep(step, sh, cmdCfg), step)
 	}
 
 	var goCode string
-	if isComplexCommand(command) {
-		goCode = generateShellCommand(command, cmdCfg.Shell, cmdCfg.ShellFlag)
+	if sh.args != nil {
+		goCode = generateSimpleCommand(sh.args)
 	} else {
-		goCode = generateSimpleCommand(command)
+		goCode = generateShellCommand(sh.script, cmdCfg.Shell, cmdCfg.ShellFlag)
+	}
+	setup := []string{
+		"cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}",
+		"cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }",
+		fmt.Sprintf("cmd.WaitDelay = %s", formatDuration(waitDelay)),
 	}
+	goCode = strings.Replace(goCode, "output, err := cmd.CombinedOutput()",
+		strings.Join(append(setup, commandSetup(step)...), "\n\t\t\t")+"\n\t\t\toutput, err := cmd.CombinedOutput()", 1)
 
 	// Handle expected exit code
-	if expectedExit != 0 {
-		goCode = wrapWithExpectedExit(goCode, expectedExit)
+	if step.ExpectedExit != 0 {
+		goCode = wrapWithExpectedExit(goCode, step.ExpectedExit)
 	}
 
-	// Wrap with retry if specified
-	if retryCount > 0 {
-		goCode = wrapWithRetry(goCode, retryCount, retryInterval)
+	// Poll with Eventually or Consistently; the timeout applies to each attempt
+	if isPolled(step) {
+		if assertion := outputAssertion(step, "output", cmdCfg); assertion != "" {
+			goCode += "\n\t\t\t" + assertion
+		}
+		if step.Timeout != "" && step.Timeout != "0" && step.Timeout != "0s" {
+			goCode = wrapWithTimeout(goCode, step.Timeout)
+		}
+		return wrapWithFailureMode(wrapWithPolling(goCode, step), step)
+	}
+
+	// Wrap with retry if specified; output assertions and captures use the last
+	// attempt, and the timeout applies to each attempt, as maxDuration counts it
+	hasTimeout := step.Timeout != "" && step.Timeout != "0" && step.Timeout != "0s"
+	if step.RetryCount > 0 {
+		timeout := ""
+		if hasTimeout {
+			timeout = step.Timeout
+		}
+		return wrapWithFailureMode(wrapWithRetry(goCode, step.RetryCount, step.RetryInterval, timeout, afterRun(step, "lastOutput", cmdCfg)), step)
+	}
+	if after := afterRun(step, "output", cmdCfg); after != "" {
+		goCode += "\n\t\t\t" + after
 	}
 
-	// Wrap with timeout if non-default (outermost — timeout applies across all retry attempts)
-	if timeout != "" && timeout != "0" && timeout != "0s" {
-		goCode = wrapWithTimeout(goCode, timeout)
+	// Wrap with timeout if non-default
+	if hasTimeout {
+		goCode = wrapWithTimeout(goCode, step.Timeout)
 	}
 
-	return goCode
+	// Soft failure handling is outermost, covering retries, timeout and assertions
+	return wrapWithFailureMode(goCode, step)
 }
 
-// isComplexCommand determines if a command needs shell execution (pipes, redirects, etc.).
-func isComplexCommand(cmd string) bool {
-	complexChars := []string{"|", "&&", "||", ";", ">", "<", ">>", "$(", "`", "&"}
-	for _, c := range complexChars {
-		if strings.Contains(cmd, c) {
-			return true
+// stepCommand decides how the command of step runs. Commands using captured
+// variables run in the shell, which expands the ${NAME} references from the
+// injected environment.
+func stepCommand(step domain.TestStep) shellCommand {
+	sh := analyzeCommand(step.Command)
+	if sh.args != nil && len(step.UsesVars) > 0 {
+		sh = shellCommand{script: strings.TrimSpace(step.Command)}
+	}
+	return sh
+}
+
+// Execution modes of a step's command.
+const (
+	ModeDirect  = "direct"  // exec of the command's words, without a shell
+	ModeShell   = "shell"   // exec of commands.shell commands.shell_flag SCRIPT
+	ModeSession = "session" // SCRIPT fed to the persistent shell of the It block
+)
+
+// StepExecution returns how the command of step runs and the argv passed to
+// exec; in a session, the argv is the shell and the script fed to it.
+func StepExecution(step domain.TestStep, cmdCfg *config.CommandConfig) (string, []string) {
+	sh := stepCommand(step)
+	switch {
+	case step.InSession:
+		script := sh.script
+		if script == "" {
+			script = strings.TrimSpace(step.Command)
 		}
+		return ModeSession, []string{cmdCfg.Shell, script}
+	case sh.args != nil:
+		return ModeDirect, sh.args
 	}
-	return false
+	return ModeShell, []string{cmdCfg.Shell, cmdCfg.ShellFlag, sh.script}
 }
 
-// heredocPattern matches heredoc operators like <<EOF, <<'EOF', <<"EOF", <<-EOF
-var heredocPattern = regexp.MustCompile(`<<-?\s*['"]?(\w+)['"]?`)
+// resolveCommandOptions reads the env, workdir and stdin attributes of a block
+// into step. env is a comma-separated list of KEY=VALUE pairs; stdin is inline
+// input (\n starts a new line) or @path to read a file, relative to workdir.
+func resolveCommandOptions(step *domain.TestStep, block domain.CodeBlock, tagCfg *config.TagConfig) error {
+	env := resolveAttribute(block.Attributes, tagCfg.Attributes["env"])
+	dir := resolveAttribute(block.Attributes, tagCfg.Attributes["workdir"])
+	stdin, hasStdin := lookupAttribute(block.Attributes, tagCfg.Attributes["stdin"])
+
+	if step.InSession && (env != "" || dir != "" || hasStdin) {
+		return fmt.Errorf("env, workdir and stdin are not supported in a persistent session — use export, cd or an input redirect in the command")
+	}
+
+	for _, kv := range strings.Split(env, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		name, _, ok := strings.Cut(kv, "=")
+		if !ok || !varNameRe.MatchString(name) {
+			return fmt.Errorf("invalid env entry %q — use KEY=VALUE pairs separated by commas", kv)
+		}
+		step.Env = append(step.Env, kv)
+	}
+
+	step.Dir = dir
+
+	if file, ok := strings.CutPrefix(stdin, "@"); ok {
+		if file == "" {
+			return fmt.Errorf("stdin=@ needs a file path")
+		}
+		if dir != "" && !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		step.StdinFile = file
+	} else if hasStdin {
+		stdin = strings.ReplaceAll(stdin, `\n`, "\n")
+		if stdin != "" && !strings.HasSuffix(stdin, "\n") {
+			stdin += "\n"
+		}
+		step.Stdin = stdin
+	}
+	return nil
+}
+
+// waitDelay bounds how long a command's output is read after it exits or is
+// killed, e.g. when a background child it spawned still holds the output pipe.
+const waitDelay = "5s"
+
+// commandSetup generates the statements configuring cmd before it runs: the
+// environment (step entries and captured variables), working directory and stdin.
+// GenerateGoCode puts the command in its own process group first, killed as a
+// whole when the context ends.
+func commandSetup(step domain.TestStep) []string {
+	var lines []string
+
+	env := make([]string, 0, len(step.Env)+len(step.UsesVars))
+	for _, kv := range step.Env {
+		env = append(env, fmt.Sprintf("%q", kv))
+	}
+	env = append(env, varEnvEntries(step.UsesVars)...)
+	if len(env) > 0 {
+		lines = append(lines, fmt.Sprintf("cmd.Env = append(os.Environ(), %s)", strings.Join(env, ", ")))
+	}
+
+	if step.Dir != "" {
+		lines = append(lines, fmt.Sprintf("cmd.Dir = %q", step.Dir))
+	}
 
-// containsHeredoc detects whether a command contains a heredoc (<<DELIM).
-func containsHeredoc(cmd string) bool {
-	return heredocPattern.MatchString(cmd)
+	switch {
+	case step.StdinFile != "":
+		lines = append(lines,
+			fmt.Sprintf("stdin, err := os.Open(%q)", step.StdinFile),
+			"Expect(err).ToNot(HaveOccurred())",
+			"defer stdin.Close()",
+			"cmd.Stdin = stdin")
+	case step.Stdin != "":
+		lines = append(lines, fmt.Sprintf("cmd.Stdin = strings.NewReader(%q)", step.Stdin))
+	}
+
+	return lines
 }
 
-// generateSimpleCommand generates exec.Command for simple commands.
-func generateSimpleCommand(command string) string {
-	parts := shellSplit(command)
+// generateSimpleCommand generates exec.CommandContext for the argv of a plain command. The
+// context is the node's SpecContext, or the step's timeout context derived from it.
+func generateSimpleCommand(parts []string) string {
 	if len(parts) == 0 {
 		return ""
 	}
 
 	if len(parts) == 1 {
-		return fmt.Sprintf(`cmd := exec.Command(%q)
+		return fmt.Sprintf(`cmd := exec.CommandContext(ctx, %q)
 			output, err := cmd.CombinedOutput()
 			Expect(err).ToNot(HaveOccurred(), string(output))`, parts[0])
 	}
@@ -100,25 +218,26 @@ func generateSimpleCommand(command string) string {
 		args[i] = fmt.Sprintf("%q", p)
 	}
 
-	return fmt.Sprintf(`cmd := exec.Command(%s)
+	return fmt.Sprintf(`cmd := exec.CommandContext(ctx, %s)
 			output, err := cmd.CombinedOutput()
 			Expect(err).ToNot(HaveOccurred(), string(output))`, strings.Join(args, ", "))
 }
 
-// generateShellCommand generates exec.Command using a shell for complex commands.
+// generateShellCommand generates exec.CommandContext running a script in the shell.
 func generateShellCommand(command, shell, shellFlag string) string {
-	return fmt.Sprintf(`cmd := exec.Command(%q, %q, %q)
+	return fmt.Sprintf(`cmd := exec.CommandContext(ctx, %q, %q, %q)
 			output, err := cmd.CombinedOutput()
 			Expect(err).ToNot(HaveOccurred(), string(output))`, shell, shellFlag, command)
 }
 
-// wrapWithTimeout wraps Go code with a context timeout.
+// wrapWithTimeout wraps Go code with a context timeout derived from the
+// node's SpecContext, so a Ginkgo interrupt or node timeout also ends it.
 func wrapWithTimeout(goCode, timeout string) string {
 	return fmt.Sprintf(`dur, err := time.ParseDuration(%q)
 			Expect(err).ToNot(HaveOccurred())
-			ctx, cancel := context.WithTimeout(context.Background(), dur)
+			ctx, cancel := context.WithTimeout(ctx, dur)
 			defer cancel()
-			%s`, timeout, strings.Replace(goCode, "exec.Command(", "exec.CommandContext(ctx, ", 1))
+			%s`, timeout, goCode)
 }
 
 // wrapWithExpectedExit modifies the assertion to check for a specific exit code.
@@ -134,9 +253,34 @@ func wrapWithExpectedExit(goCode string, expectedExit int) string {
 		1)
 }
 
+// wrapWithFailureMode runs the step code under InterceptGomegaFailure when the
+// step may fail softly. On failure (command error, exit code, timeout or output
+// assertion) skip-on-failure skips the rest of the spec with the failure message,
+// which includes the output, and continue-on-error logs it to GinkgoWriter.
+func wrapWithFailureMode(goCode string, step domain.TestStep) string {
+	var onFailure string
+	switch {
+	case step.SkipOnFailure:
+		onFailure = fmt.Sprintf("Skip(%q + failure.Error())", fmt.Sprintf("step %q failed: ", step.Name))
+	case step.ContinueOnError:
+		onFailure = fmt.Sprintf("GinkgoWriter.Printf(\"step %%q failed, continuing: %%v\\n\", %q, failure)", step.Name)
+	default:
+		return goCode
+	}
+
+	return fmt.Sprintf(`if failure := InterceptGomegaFailure(func() {
+				%s
+			}); failure != nil {
+				%s
+			}`, goCode, onFailure)
+}
+
 // wrapWithRetry wraps Go code with a retry loop.
 // retryCount is the number of retries (e.g. 3 means 4 total attempts: 1 initial + 3 retries).
-func wrapWithRetry(goCode string, retryCount int, retryInterval string) string {
+// A non-empty timeout limits each attempt, which runs in its own function so
+// that its context is cancelled before the next one.
+// after is appended once the loop has finished (e.g. an output assertion on lastOutput).
+func wrapWithRetry(goCode string, retryCount int, retryInterval string, timeout string, after string) string {
 	totalAttempts := retryCount + 1
 
 	// Extract the assertion line and the command setup lines
@@ -165,7 +309,7 @@ func wrapWithRetry(goCode string, retryCount int, retryInterval string) string {
 		exitCheckStart := strings.Index(retryCode, "if exitErr, ok := lastErr.(*exec.ExitError)")
 		if exitCheckStart >= 0 {
 			exitBlock := retryCode[exitCheckStart:]
-			retryCode = retryCode[:exitCheckStart]
+			retryCode = attemptCode(retryCode[:exitCheckStart], timeout)
 			// Build the retry loop with the exit check after
 			return fmt.Sprintf(`{
 			var lastOutput []byte
@@ -179,12 +323,13 @@ func wrapWithRetry(goCode string, retryCount int, retryInterval string) string {
 					time.Sleep(%s)
 				}
 			}
-			%s
-		}`, totalAttempts, strings.TrimSpace(retryCode), retryCount, formatDuration(retryInterval), strings.TrimSpace(exitBlock))
+			%s%s
+		}`, totalAttempts, strings.TrimSpace(retryCode), retryCount, formatDuration(retryInterval), strings.TrimSpace(exitBlock), afterLoop(after))
 		}
 	}
 
 	// Standard case (no expected exit code)
+	retryCode = attemptCode(retryCode, timeout)
 	return fmt.Sprintf(`{
 			var lastOutput []byte
 			var lastErr error
@@ -197,8 +342,59 @@ func wrapWithRetry(goCode string, retryCount int, retryInterval string) string {
 					time.Sleep(%s)
 				}
 			}
-			Expect(lastErr).ToNot(HaveOccurred(), string(lastOutput))
-		}`, totalAttempts, strings.TrimSpace(retryCode), retryCount, formatDuration(retryInterval))
+			Expect(lastErr).ToNot(HaveOccurred(), string(lastOutput))%s
+		}`, totalAttempts, strings.TrimSpace(retryCode), retryCount, formatDuration(retryInterval), afterLoop(after))
+}
+
+// attemptCode returns the code of one retry attempt, under its own timeout
+// when one is set.
+func attemptCode(code, timeout string) string {
+	if timeout == "" {
+		return code
+	}
+	return fmt.Sprintf(`func() {
+				%s
+			}()`, wrapWithTimeout(strings.TrimSpace(code), timeout))
+}
+
+// afterRun generates the code that runs once the command succeeded: output
+// assertions followed by the capture of the output into a variable.
+func afterRun(step domain.TestStep, outputVar string, cmdCfg *config.CommandConfig) string {
+	var parts []string
+	for _, code := range []string{outputAssertion(step, outputVar, cmdCfg), captureCode(step, outputVar)} {
+		if code != "" {
+			parts = append(parts, code)
+		}
+	}
+	return strings.Join(parts, "\n\t\t\t")
+}
+
+// afterLoop formats code placed after a retry loop, on its own line.
+func afterLoop(code string) string {
+	if code == "" {
+		return ""
+	}
+	return "\n\t\t\t" + code
+}
+
+// maxDuration returns the longest time a step can run: each attempt is bounded
+// by the timeout, retries add their interval and polling its whole duration.
+// It returns 0 when the step has no timeout and can run indefinitely.
+func maxDuration(step domain.TestStep) time.Duration {
+	timeout, err := time.ParseDuration(step.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0
+	}
+
+	switch {
+	case step.Eventually != "" || step.Consistently != "":
+		within, _ := time.ParseDuration(step.Eventually + step.Consistently)
+		return within + timeout
+	case step.RetryCount > 0:
+		interval, _ := time.ParseDuration(step.RetryInterval)
+		return time.Duration(step.RetryCount+1)*timeout + time.Duration(step.RetryCount)*interval
+	}
+	return timeout
 }
 
 // formatDuration converts a duration string like "5s" into a Go expression like "5 * time.Second".
@@ -220,38 +416,3 @@ func formatDuration(d string) string {
 	// Fallback: use time.ParseDuration at runtime
 	return fmt.Sprintf("func() time.Duration { d, _ := time.ParseDuration(%q); return d }()", d)
 }
-
-// shellSplit splits a command string into arguments, respecting quotes.
-func shellSplit(s string) []string {
-	var parts []string
-	var current strings.Builder
-	inQuote := false
-	quoteChar := byte(0)
-
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if inQuote {
-			if c == quoteChar {
-				inQuote = false
-			} else {
-				current.WriteByte(c)
-			}
-		} else {
-			if c == '"' || c == '\'' {
-				inQuote = true
-				quoteChar = c
-			} else if c == ' ' || c == '\t' {
-				if current.Len() > 0 {
-					parts = append(parts, current.String())
-					current.Reset()
-				}
-			} else {
-				current.WriteByte(c)
-			}
-		}
-	}
-	if current.Len() > 0 {
-		parts = append(parts, current.String())
-	}
-	return parts
-}
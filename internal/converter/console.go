@@ -0,0 +1,71 @@
+package converter
+
+import (
+	"regexp"
+	"strings"
+)
+
+// consoleCommand is one prompt command of a console session block together
+// with the sample output shown after it.
+type consoleCommand struct {
+	command string
+	output  string
+	offset  int // line offset of the prompt line within the block
+}
+
+// continuationPromptRe matches the secondary ("> ") prompt on continuation lines.
+var continuationPromptRe = regexp.MustCompile(`^\s*>\s?`)
+
+// splitConsoleSession splits a console session such as
+//
+//	$ kubectl get pods \
+//	>   -n demo
+//	NAME    READY   STATUS
+//	web-1   1/1     Running
+//
+// into commands and their output. Only lines matching prompt start a command;
+// a trailing backslash continues the command on the next line, and the lines
+// that follow until the next prompt are the command's output. Lines before the
+// first prompt are ignored.
+func splitConsoleSession(content string, prompt *regexp.Regexp) []consoleCommand {
+	var cmds []consoleCommand
+	var output []string
+	flush := func() {
+		if len(cmds) > 0 {
+			cmds[len(cmds)-1].output = strings.TrimRight(strings.Join(output, "\n"), "\n ")
+		}
+		output = nil
+	}
+
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		loc := prompt.FindStringIndex(lines[i])
+		if loc == nil {
+			if len(cmds) > 0 {
+				output = append(output, lines[i])
+			}
+			continue
+		}
+		flush()
+
+		cmd := consoleCommand{offset: i}
+		parts := []string{strings.TrimSpace(lines[i][loc[1]:])}
+		for strings.HasSuffix(parts[len(parts)-1], `\`) && i+1 < len(lines) {
+			parts[len(parts)-1] = strings.TrimSpace(strings.TrimSuffix(parts[len(parts)-1], `\`))
+			i++
+			parts = append(parts, strings.TrimSpace(continuationPromptRe.ReplaceAllString(lines[i], "")))
+		}
+		cmd.command = strings.Join(parts, " ")
+		cmds = append(cmds, cmd)
+	}
+	flush()
+
+	// A bare prompt carries no command
+	kept := cmds[:0]
+	for _, c := range cmds {
+		if c.command != "" {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
@@ -1,8 +1,10 @@
 package converter
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -18,11 +20,29 @@ type Converter interface {
 // DefaultConverter implements Converter.
 type DefaultConverter struct {
 	cmdConfig *config.CommandConfig
+	policy    *CommandPolicy
+	prompt    *regexp.Regexp // commands.console_prompt
 }
 
-// NewConverter creates a new DefaultConverter.
-func NewConverter(cmdCfg *config.CommandConfig) *DefaultConverter {
-	return &DefaultConverter{cmdConfig: cmdCfg}
+// NewConverter creates a new DefaultConverter, compiling the command policy
+// and the console prompt of cmdCfg once. It fails when either is invalid.
+func NewConverter(cmdCfg *config.CommandConfig) (*DefaultConverter, error) {
+	policy, err := NewCommandPolicy(cmdCfg)
+	if err != nil {
+		return nil, err
+	}
+	prompt, err := regexp.Compile(cmdCfg.ConsolePrompt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commands.console_prompt %q: %w", cmdCfg.ConsolePrompt, err)
+	}
+	return &DefaultConverter{cmdConfig: cmdCfg, policy: policy, prompt: prompt}, nil
+}
+
+// CollectDenied makes Convert keep the commands denied by the command policy,
+// with their findings, instead of failing on the first one. Only audits use
+// it: the steps it returns must not be generated.
+func (c *DefaultConverter) CollectDenied() {
+	c.policy.CollectDenied()
 }
 
 // Convert transforms a ParsedDocument into a slice of TestSpecs.
@@ -34,9 +54,28 @@ func (c *DefaultConverter) Convert(doc *domain.ParsedDocument, tagCfg *config.Ta
 		return nil, nil
 	}
 
-	// Determine describe block from the first heading
-	describeBlock := inferDescribeBlock(doc)
-	contextBlock := inferContextBlock(doc)
+	// Document metadata (front matter / header attributes) supplies per-document defaults
+	defaults := resolveDocDefaults(doc.Metadata, tagCfg)
+	if defaults.session == "" {
+		defaults.session = c.cmdConfig.Session
+	}
+	if defaults.session == "" {
+		defaults.session = SessionIsolated
+	}
+
+	// Determine describe block from metadata or the first heading
+	describeBlock := defaults.describe
+	if describeBlock == "" {
+		describeBlock = inferDescribeBlock(doc)
+	}
+	contextBlock := defaults.context
+	if contextBlock == "" {
+		contextBlock = inferContextBlock(doc)
+	}
+
+	// Variables captured anywhere in the document; ${NAME} references to them
+	// must follow the capturing step within the same It block
+	docCaptures := captureNames(doc.Blocks, tagCfg)
 
 	// Fallback test name from filename
 	base := filepath.Base(doc.FilePath)
@@ -56,7 +95,11 @@ func (c *DefaultConverter) Convert(doc *domain.ParsedDocument, tagCfg *config.Ta
 
 	var specs []domain.TestSpec
 	for _, testFile := range testFileOrder {
-		blocks := testFileBlocks[testFile]
+		// Setup and cleanup blocks apply to every It block of this Describe
+		phases, blocks, err := c.splitPhases(doc, testFileBlocks[testFile], tagCfg, defaults, docCaptures)
+		if err != nil {
+			return nil, err
+		}
 
 		// Level 2: Sub-group by StepGroup within this TestFile group
 		var stepGroupOrder []string
@@ -78,16 +121,53 @@ func (c *DefaultConverter) Convert(doc *domain.ParsedDocument, tagCfg *config.Ta
 		for _, stepGroup := range stepGroupOrder {
 			sgBlocks := stepGroupBlocks[stepGroup]
 
+			// The session mode applies to every step of the It block
+			groupDefaults := defaults
+			session, err := groupSession(doc, sgBlocks, tagCfg, defaults.session)
+			if err != nil {
+				return nil, err
+			}
+			groupDefaults.session = session
+
 			// Convert blocks to steps
 			var steps []domain.TestStep
+			captured := make(map[string]bool)
 			for i, block := range sgBlocks {
-				// Validate command security
-				if err := ValidateCommand(block.Content, c.cmdConfig.BlockedPatterns); err != nil {
-					return nil, domain.NewError("convert", doc.FilePath, block.LineNumber, err.Error(), nil)
+				// Output blocks attach an assertion to the step right before them
+				if isOutputTag(block.Tag, tagCfg) {
+					var last *domain.TestStep
+					if i > 0 && !isOutputTag(sgBlocks[i-1].Tag, tagCfg) {
+						last = &steps[len(steps)-1]
+					}
+					if err := c.attachOutput(doc, last, block, tagCfg); err != nil {
+						return nil, err
+					}
+					continue
 				}
 
-				step := c.blockToStep(block, i, tagCfg)
-				steps = append(steps, step)
+				blockSteps, err := c.blockSteps(doc, block, i, tagCfg, groupDefaults)
+				if err != nil {
+					return nil, err
+				}
+
+				// Captured variables must be set by an earlier step of this It block
+				for _, step := range blockSteps {
+					if refs := referencedVars(step.Command, docCaptures); len(refs) > 0 {
+						for _, ref := range refs {
+							if !captured[ref] {
+								return nil, domain.NewErrorWithSuggestion("convert", blockFile(doc, block), step.LineNumber,
+									fmt.Sprintf("${%s} is not captured by an earlier step of this test", ref),
+									fmt.Sprintf("add capture=%s to a step before this one in the same test", ref), nil)
+							}
+						}
+						step.UsesVars = refs
+						step.GoCode = GenerateGoCode(step, c.cmdConfig)
+					}
+					if step.CaptureVar != "" {
+						captured[step.CaptureVar] = true
+					}
+					steps = append(steps, step)
+				}
 			}
 
 			// Determine test name (It block name):
@@ -103,14 +183,23 @@ func (c *DefaultConverter) Convert(doc *domain.ParsedDocument, tagCfg *config.Ta
 			}
 
 			spec := domain.TestSpec{
-				SourceFile:    doc.FilePath,
-				SourceType:    doc.FileType,
-				TestName:      testName,
-				DescribeBlock: specDescribe,
-				ContextBlock:  contextBlock,
-				Steps:         steps,
-				TemplateName:  "",
-				TestFile:      testFile,
+				SourceFile:     doc.FilePath,
+				SourceType:     doc.FileType,
+				TestName:       testName,
+				DescribeBlock:  specDescribe,
+				ContextBlock:   contextBlock,
+				Steps:          steps,
+				TemplateName:   defaults.template,
+				TestFile:       testFile,
+				Labels:         defaults.labels,
+				Skip:           defaults.skip,
+				SetupSteps:     phases.setup,
+				CleanupSteps:   phases.cleanup,
+				BeforeAllSteps: phases.beforeAll,
+				AfterAllSteps:  phases.afterAll,
+			}
+			if session == SessionPersistent {
+				spec.SessionCode = sessionSetupCode(c.cmdConfig)
 			}
 
 			// Check for template override in any block attribute
@@ -133,15 +222,177 @@ func (c *DefaultConverter) Convert(doc *domain.ParsedDocument, tagCfg *config.Ta
 	return specs, nil
 }
 
-// blockToStep converts a single CodeBlock to a TestStep.
-func (c *DefaultConverter) blockToStep(block domain.CodeBlock, index int, tagCfg *config.TagConfig) domain.TestStep {
+// blockSteps converts a step block into steps: one per prompt command for
+// console session blocks, else a single step. The steps keep the file the
+// block was read from.
+func (c *DefaultConverter) blockSteps(doc *domain.ParsedDocument, block domain.CodeBlock, index int, tagCfg *config.TagConfig, defaults docDefaults) ([]domain.TestStep, error) {
+	var steps []domain.TestStep
+	if isTrue(resolveAttribute(block.Attributes, tagCfg.Attributes["console"])) {
+		var err error
+		steps, err = c.consoleToSteps(block, index, tagCfg, defaults)
+		var serr *shellSyntaxError
+		if errors.As(err, &serr) {
+			return nil, shellSyntaxDocError(doc, block, serr)
+		}
+		if err != nil {
+			return nil, domain.NewError("convert", blockFile(doc, block), block.LineNumber, err.Error(), nil)
+		}
+	} else {
+		step, err := c.blockToStep(block, index, tagCfg, defaults)
+		var serr *shellSyntaxError
+		if errors.As(err, &serr) {
+			return nil, shellSyntaxDocError(doc, block, serr)
+		}
+		if err != nil {
+			return nil, domain.NewErrorWithSuggestion("convert", blockFile(doc, block), block.LineNumber, err.Error(),
+				"fix the attribute of this block named in the error", nil)
+		}
+		steps = []domain.TestStep{step}
+	}
+
+	for i := range steps {
+		steps[i].SourceFile = blockFile(doc, block)
+	}
+	return c.checkPolicy(doc, block, tagCfg, steps)
+}
+
+// checkPolicy applies the command policy to the commands of steps, keeping
+// the warn and allow rules that matched, and the deny rules bypassed by the
+// block's allow-blocked attribute, in their PolicyFindings.
+func (c *DefaultConverter) checkPolicy(doc *domain.ParsedDocument, block domain.CodeBlock, tagCfg *config.TagConfig, steps []domain.TestStep) ([]domain.TestStep, error) {
+	var override *Override
+	var err error
+	if value, ok := lookupAttribute(block.Attributes, tagCfg.Attributes["allow_blocked"]); ok {
+		if !c.cmdConfig.AllowOverrides {
+			return nil, domain.NewErrorWithSuggestion("convert", blockFile(doc, block), block.LineNumber,
+				"allow-blocked is disabled by commands.allow_overrides in docsyncer.yaml",
+				"remove the attribute, or change the rule in commands.policy.rules", nil)
+		}
+		if override, err = ParseOverride(value); err != nil {
+			return nil, domain.NewError("convert", blockFile(doc, block), block.LineNumber, err.Error(), nil)
+		}
+	}
+
+	bypassed := make(map[string]bool)
+	for i := range steps {
+		findings, err := c.policy.Check(blockFile(doc, block), steps[i].Command, steps[i].LineNumber, override)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range findings {
+			if f.Override != "" {
+				bypassed[f.Rule] = true
+			}
+		}
+		steps[i].PolicyFindings = findings
+	}
+
+	// An override that bypasses nothing is stale or names the wrong rule
+	if override != nil {
+		for _, rule := range override.Rules {
+			if !bypassed[rule] {
+				return nil, domain.NewErrorWithSuggestion("convert", blockFile(doc, block), block.LineNumber,
+					fmt.Sprintf("allow-blocked names rule %q, which denies no command of this block", rule),
+					"name the rule given in the policy error, or remove the attribute", nil)
+			}
+		}
+	}
+	return steps, nil
+}
+
+// shellSyntaxDocError reports a command of block that does not parse, at the
+// line of the document where the parser stopped.
+func shellSyntaxDocError(doc *domain.ParsedDocument, block domain.CodeBlock, serr *shellSyntaxError) error {
+	return domain.NewErrorWithSuggestion("convert", blockFile(doc, block), serr.Line, serr.Error(),
+		"fix the shell syntax of the command, e.g. an unclosed quote, if or loop", nil)
+}
+
+// attachOutput attaches the assertion of an output block to step, the step
+// right before it; step is nil when no step block precedes the output block.
+func (c *DefaultConverter) attachOutput(doc *domain.ParsedDocument, step *domain.TestStep, block domain.CodeBlock, tagCfg *config.TagConfig) error {
+	if step == nil {
+		return domain.NewErrorWithSuggestion("convert", blockFile(doc, block), block.LineNumber,
+			fmt.Sprintf("%s block does not follow a step block", block.Tag),
+			"place the output block directly after the step whose output it shows", nil)
+	}
+	if step.Background {
+		return domain.NewErrorWithSuggestion("convert", blockFile(doc, block), block.LineNumber,
+			fmt.Sprintf("%s block follows a background step", block.Tag),
+			"a background step keeps running — wait for its output with ready-when='log:REGEX' instead", nil)
+	}
+	mode, err := outputMatchMode(block, tagCfg, MatchContains)
+	if err != nil {
+		return domain.NewError("convert", blockFile(doc, block), block.LineNumber, err.Error(), nil)
+	}
+	step.ExpectedOutput = block.Content
+	step.OutputMatch = mode
+	if err := checkOutputRegex(*step); err != nil {
+		return domain.NewErrorWithSuggestion("convert", blockFile(doc, block), block.LineNumber, err.Error(),
+			"fix the regular expression, or use match=contains to compare literal text", nil)
+	}
+	step.GoCode = GenerateGoCode(*step, c.cmdConfig)
+	return nil
+}
+
+// docDefaults holds per-document defaults taken from ParsedDocument.Metadata.
+type docDefaults struct {
+	describe string
+	context  string
+	labels   []string
+	template string
+	timeout  string
+	skip     string // skip reason, empty when the document is not skipped
+	session  string // session mode of the It blocks
+}
+
+// resolveDocDefaults reads per-document defaults from document metadata, using
+// the same attribute synonyms as code block attributes.
+func resolveDocDefaults(meta map[string]string, tagCfg *config.TagConfig) docDefaults {
+	d := docDefaults{
+		describe: resolveAttribute(meta, tagCfg.Attributes["describe"]),
+		context:  resolveAttribute(meta, tagCfg.Attributes["context"]),
+		template: resolveAttribute(meta, tagCfg.Attributes["template"]),
+		timeout:  resolveAttribute(meta, tagCfg.Attributes["timeout"]),
+		session:  resolveAttribute(meta, tagCfg.Attributes["session"]),
+	}
+
+	for _, l := range strings.Split(resolveAttribute(meta, tagCfg.Attributes["labels"]), ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			d.labels = append(d.labels, l)
+		}
+	}
+
+	switch skip := strings.TrimSpace(resolveAttribute(meta, tagCfg.Attributes["skip"])); skip {
+	case "", "false", "no":
+	case "true", "yes":
+		d.skip = "skipped by document metadata"
+	default:
+		d.skip = skip
+	}
+
+	return d
+}
+
+// blockToStep converts a single CodeBlock to a TestStep. It fails when a failure
+// mode, polling, env, stdin, capture, structured output assertion or background
+// attribute is invalid.
+func (c *DefaultConverter) blockToStep(block domain.CodeBlock, index int, tagCfg *config.TagConfig, defaults docDefaults) (domain.TestStep, error) {
 	step := domain.TestStep{
 		Command:    block.Content,
 		LineNumber: block.LineNumber,
+		InSession:  defaults.session == SessionPersistent,
+	}
+
+	// Reject commands the shell cannot run before looking at the attributes
+	if err := checkShellSyntax(block.Content, block.LineNumber); err != nil {
+		return step, err
 	}
 
 	// Resolve step name from attributes
 	step.Name = resolveAttribute(block.Attributes, tagCfg.Attributes["step_name"])
+	if step.Name == "" {
+		step.Name = block.Title
+	}
 	if step.Name == "" {
 		// Auto-generate from command
 		step.Name = autoStepName(block.Content, index)
@@ -149,6 +400,9 @@ func (c *DefaultConverter) blockToStep(block domain.CodeBlock, index int, tagCfg
 
 	// Resolve timeout
 	timeout := resolveAttribute(block.Attributes, tagCfg.Attributes["timeout"])
+	if timeout == "" {
+		timeout = defaults.timeout
+	}
 	if timeout == "" {
 		timeout = c.cmdConfig.DefaultTimeout
 	}
@@ -164,9 +418,12 @@ func (c *DefaultConverter) blockToStep(block domain.CodeBlock, index int, tagCfg
 		step.ExpectedExit = c.cmdConfig.DefaultExpectedExitCode
 	}
 
-	// Resolve skip on failure
-	skipStr := resolveAttribute(block.Attributes, tagCfg.Attributes["skip_on_failure"])
-	step.SkipOnFailure = skipStr == "true" || skipStr == "yes"
+	// Resolve soft failure handling: skip the rest of the spec, or log and go on
+	step.SkipOnFailure = isTrue(resolveAttribute(block.Attributes, tagCfg.Attributes["skip_on_failure"]))
+	step.ContinueOnError = isTrue(resolveAttribute(block.Attributes, tagCfg.Attributes["continue_on_error"]))
+	if step.SkipOnFailure && step.ContinueOnError {
+		return step, fmt.Errorf("skip-on-failure and continue-on-error cannot be combined — choose one")
+	}
 
 	// Resolve retry count
 	retryStr := resolveAttribute(block.Attributes, tagCfg.Attributes["retry"])
@@ -183,20 +440,150 @@ func (c *DefaultConverter) blockToStep(block domain.CodeBlock, index int, tagCfg
 	}
 	step.RetryInterval = retryInterval
 
+	// Resolve polling with Eventually or Consistently instead of a fixed number of retries
+	if err := resolvePolling(&step, block, tagCfg); err != nil {
+		return step, err
+	}
+
+	// Resolve the command's environment, working directory and stdin
+	if err := resolveCommandOptions(&step, block, tagCfg); err != nil {
+		return step, err
+	}
+
+	// Resolve output capture into a variable for later steps
+	if err := resolveCapture(&step, block, tagCfg); err != nil {
+		return step, err
+	}
+
+	// Resolve structured output assertions, validating them at generation time
+	for _, s := range []struct {
+		attr, format, syntax string
+	}{
+		{"expect_json", "json", SyntaxJQ},
+		{"expect_jsonpath", "json", SyntaxJSONPath},
+		{"expect_yaml", "yaml", SyntaxJQ},
+	} {
+		expr := resolveAttribute(block.Attributes, tagCfg.Attributes[s.attr])
+		if expr == "" {
+			continue
+		}
+		a := domain.StructuredAssertion{Format: s.format, Syntax: s.syntax, Expr: expr}
+		if _, err := parseStructuredAssertion(a); err != nil {
+			return step, err
+		}
+		step.StructuredAssertions = append(step.StructuredAssertions, a)
+	}
+
+	// Resolve background processes, checked against the settings above
+	if err := resolveBackground(&step, block, tagCfg); err != nil {
+		return step, err
+	}
+
+	// Bound the step's running time for the NodeTimeout of its Ginkgo node
+	step.MaxDuration = maxDuration(step)
+
 	// Generate Go code
-	step.GoCode = GenerateGoCode(block.Content, step.ExpectedExit, step.Timeout, step.RetryCount, step.RetryInterval, c.cmdConfig)
+	step.GoCode = GenerateGoCode(step, c.cmdConfig)
 
-	return step
+	return step, nil
+}
+
+// consoleToSteps converts a console session block into one step per prompt
+// command, keeping the output shown after each command as its ExpectedOutput.
+// A step name given on the block is numbered when the session has several commands.
+func (c *DefaultConverter) consoleToSteps(block domain.CodeBlock, index int, tagCfg *config.TagConfig, defaults docDefaults) ([]domain.TestStep, error) {
+	cmds := splitConsoleSession(block.Content, c.prompt)
+	if len(cmds) == 0 {
+		return nil, fmt.Errorf("console block has no lines matching the prompt %q — check commands.console_prompt in docsyncer.yaml", c.cmdConfig.ConsolePrompt)
+	}
+
+	name := resolveAttribute(block.Attributes, tagCfg.Attributes["step_name"])
+	if name == "" {
+		name = block.Title
+	}
+
+	// A match attribute asserts each command's output
+	mode, err := outputMatchMode(block, tagCfg, "")
+	if err != nil {
+		return nil, err
+	}
+
+	steps := make([]domain.TestStep, 0, len(cmds))
+	for j, cmd := range cmds {
+		cmdBlock := block
+		cmdBlock.Content = cmd.command
+		cmdBlock.LineNumber = block.LineNumber + cmd.offset
+		step, err := c.blockToStep(cmdBlock, index, tagCfg, defaults)
+		if err != nil {
+			return nil, err
+		}
+		if name != "" && len(cmds) > 1 {
+			step.Name = fmt.Sprintf("%s (%d/%d)", name, j+1, len(cmds))
+		}
+		step.ExpectedOutput = cmd.output
+		if mode != "" {
+			step.OutputMatch = mode
+			if err := checkOutputRegex(step); err != nil {
+				return nil, err
+			}
+			step.GoCode = GenerateGoCode(step, c.cmdConfig)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// isOutputTag reports whether tag is one of the configured output block tags.
+func isOutputTag(tag string, tagCfg *config.TagConfig) bool {
+	for _, t := range tagCfg.OutputTags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// outputMatchMode resolves the match attribute of a block, falling back to def.
+func outputMatchMode(block domain.CodeBlock, tagCfg *config.TagConfig, def string) (string, error) {
+	mode := resolveAttribute(block.Attributes, tagCfg.Attributes["match"])
+	if mode == "" {
+		return def, nil
+	}
+	if !isValidMatchMode(mode) {
+		return "", fmt.Errorf("unknown output match mode %q — use one of: %s", mode, strings.Join(validMatchModes, ", "))
+	}
+	return mode, nil
+}
+
+// isTrue reports whether a boolean attribute value is set.
+func isTrue(val string) bool {
+	return val == "true" || val == "yes"
+}
+
+// blockFile returns the file a block's line number refers to: the included
+// file it came from, or the document itself.
+func blockFile(doc *domain.ParsedDocument, block domain.CodeBlock) string {
+	if block.SourceFile != "" {
+		return block.SourceFile
+	}
+	return doc.FilePath
 }
 
 // resolveAttribute looks up an attribute value using a list of possible key names.
 func resolveAttribute(attrs map[string]string, keys []string) string {
+	val, _ := lookupAttribute(attrs, keys)
+	return val
+}
+
+// lookupAttribute is like resolveAttribute but also reports whether the
+// attribute is present, so an explicitly empty value can be told apart.
+func lookupAttribute(attrs map[string]string, keys []string) (string, bool) {
 	for _, key := range keys {
 		if val, ok := attrs[key]; ok {
-			return val
+			return val, true
 		}
 	}
-	return ""
+	return "", false
 }
 
 // autoStepName generates a step name from the command content.
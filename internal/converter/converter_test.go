@@ -1,6 +1,12 @@
 package converter_test
 
 import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
@@ -23,6 +29,7 @@ var _ = Describe("Converter", func() {
 			BlockedPatterns:         []string{"rm -rf /", "mkfs"},
 			Shell:                   "/bin/sh",
 			ShellFlag:               "-c",
+			ConsolePrompt:           `^\s*\$\s+`,
 		}
 		tagCfg = &config.TagConfig{
 			StepTags: []string{"go-e2e-step"},
@@ -36,7 +43,9 @@ var _ = Describe("Converter", func() {
 				"retry_interval":   {"retry-interval", "retry-delay"},
 			},
 		}
-		conv = converter.NewConverter(cmdCfg)
+		var err error
+		conv, err = converter.NewConverter(cmdCfg)
+		Expect(err).ToNot(HaveOccurred())
 	})
 
 	Describe("Convert", func() {
@@ -67,6 +76,24 @@ var _ = Describe("Converter", func() {
 			Expect(specs[0].Steps[0].GoCode).To(ContainSubstring("exec.Command"))
 		})
 
+		It("should use the block title as the step name when no step-name is given", func() {
+			doc := &domain.ParsedDocument{
+				FilePath: "test.adoc",
+				FileType: "asciidoc",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "kubectl get pods", LineNumber: 4, Title: "Verify the pods", Attributes: map[string]string{}},
+					{Tag: "go-e2e-step", Content: "kubectl get svc", LineNumber: 9, Title: "Ignored", Attributes: map[string]string{"step-name": "List services"}},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps[0].Name).To(Equal("Verify the pods"))
+			Expect(specs[0].Steps[1].Name).To(Equal("List services"))
+		})
+
 		It("should return nil for document with no blocks", func() {
 			doc := &domain.ParsedDocument{
 				FilePath: "empty.md",
@@ -154,6 +181,68 @@ var _ = Describe("Converter", func() {
 			Expect(err.Error()).To(ContainSubstring("blocked"))
 		})
 
+		It("should keep every denied command as a finding once CollectDenied is set", func() {
+			conv.CollectDenied()
+			doc := &domain.ParsedDocument{
+				FilePath: "test.md",
+				FileType: "markdown",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "rm -rf /", LineNumber: 3, Attributes: map[string]string{}},
+					{Tag: "go-e2e-step", Content: "kubectl get pods", LineNumber: 7, Attributes: map[string]string{}},
+					{Tag: "go-e2e-step", Content: "mkfs /dev/sdb", LineNumber: 11, Attributes: map[string]string{}},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps).To(HaveLen(3))
+			Expect(specs[0].Steps[0].PolicyFindings).To(Equal([]domain.PolicyFinding{
+				{Rule: "blocked_patterns", Action: "deny", Command: "rm -rf /", File: "test.md", Line: 3, Message: `matches "rm -rf /"`},
+			}))
+			Expect(specs[0].Steps[1].PolicyFindings).To(BeEmpty())
+			Expect(specs[0].Steps[2].PolicyFindings).To(Equal([]domain.PolicyFinding{
+				{Rule: "blocked_patterns", Action: "deny", Command: "mkfs /dev/sdb", File: "test.md", Line: 11, Message: `matches "mkfs"`},
+			}))
+		})
+
+		It("should report blocked commands in the file that contributed the block", func() {
+			doc := &domain.ParsedDocument{
+				FilePath: "guide.adoc",
+				FileType: "asciidoc",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "rm -rf /", LineNumber: 7, SourceFile: "partials/cleanup.adoc", Attributes: map[string]string{}},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+
+			_, err := conv.Convert(doc, tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("partials/cleanup.adoc:7"))
+		})
+
+		It("should keep the file each step's block was read from", func() {
+			doc := &domain.ParsedDocument{
+				FilePath: "guide.adoc",
+				FileType: "asciidoc",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "kubectl get pods", LineNumber: 3, Attributes: map[string]string{}},
+					{Tag: "go-e2e-step", Content: "kubectl delete ns demo", LineNumber: 7, SourceFile: "partials/cleanup.adoc", Attributes: map[string]string{}},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs).To(HaveLen(1))
+			Expect(specs[0].Steps).To(HaveLen(2))
+			Expect(specs[0].Steps[0].SourceFile).To(Equal("guide.adoc"))
+			Expect(specs[0].Steps[1].SourceFile).To(Equal("partials/cleanup.adoc"))
+		})
+
 		It("should use TestFile name as Describe block when set", func() {
 			doc := &domain.ParsedDocument{
 				FilePath: "test.md",
@@ -238,7 +327,7 @@ var _ = Describe("Converter", func() {
 
 	Describe("GenerateGoCode", func() {
 		It("should generate simple exec.Command for basic commands", func() {
-			code := converter.GenerateGoCode("kubectl get pods", 0, "30s", 0, "", cmdCfg)
+			code := converter.GenerateGoCode(domain.TestStep{Command: "kubectl get pods", Timeout: "30s"}, cmdCfg)
 			Expect(code).To(ContainSubstring("exec.Command"))
 			Expect(code).To(ContainSubstring("kubectl"))
 			Expect(code).To(ContainSubstring("get"))
@@ -246,33 +335,64 @@ var _ = Describe("Converter", func() {
 		})
 
 		It("should use shell for complex commands with pipes", func() {
-			code := converter.GenerateGoCode("cat file | grep test", 0, "30s", 0, "", cmdCfg)
+			code := converter.GenerateGoCode(domain.TestStep{Command: "cat file | grep test", Timeout: "30s"}, cmdCfg)
 			Expect(code).To(ContainSubstring("/bin/sh"))
 			Expect(code).To(ContainSubstring("-c"))
 		})
 
+		It("should configure env, working directory and inline stdin for simple commands", func() {
+			code := converter.GenerateGoCode(domain.TestStep{Command: "cat", Env: []string{"NS=demo"}, Dir: "examples/app", Stdin: "y\n"}, cmdCfg)
+			Expect(code).To(ContainSubstring(`cmd := exec.CommandContext(ctx, "cat")`))
+			Expect(code).To(ContainSubstring(`cmd.Env = append(os.Environ(), "NS=demo")`))
+			Expect(code).To(ContainSubstring(`cmd.Dir = "examples/app"`))
+			Expect(code).To(ContainSubstring(`cmd.Stdin = strings.NewReader("y\n")`))
+			Expect(strings.Index(code, "cmd.Stdin")).To(BeNumerically("<", strings.Index(code, "cmd.CombinedOutput()")))
+		})
+
+		It("should open a stdin file for shell commands", func() {
+			code := converter.GenerateGoCode(domain.TestStep{Command: "sort | uniq", StdinFile: "data/in.txt", Timeout: "30s"}, cmdCfg)
+			Expect(code).To(ContainSubstring(`exec.CommandContext(ctx, "/bin/sh", "-c", "sort | uniq")`))
+			Expect(code).To(ContainSubstring(`stdin, err := os.Open("data/in.txt")`))
+			Expect(code).To(ContainSubstring("cmd.Stdin = stdin"))
+		})
+
 		It("should wrap with timeout", func() {
-			code := converter.GenerateGoCode("echo hello", 0, "60s", 0, "", cmdCfg)
+			code := converter.GenerateGoCode(domain.TestStep{Command: "echo hello", Timeout: "60s"}, cmdCfg)
 			Expect(code).To(ContainSubstring("time.ParseDuration"))
 			Expect(code).To(ContainSubstring("context.WithTimeout"))
 			Expect(code).To(ContainSubstring("CommandContext"))
 		})
 
+		It("should derive the timeout from the SpecContext and kill the process group on cancel", func() {
+			code := converter.GenerateGoCode(domain.TestStep{Command: "kubectl port-forward svc/web 8080:80", Timeout: "60s"}, cmdCfg)
+			Expect(code).To(ContainSubstring("ctx, cancel := context.WithTimeout(ctx, dur)"))
+			Expect(code).ToNot(ContainSubstring("context.Background()"))
+			Expect(code).To(ContainSubstring("cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}"))
+			Expect(code).To(ContainSubstring("cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }"))
+			Expect(code).To(ContainSubstring("cmd.WaitDelay = 5 * time.Second"))
+		})
+
+		It("should run commands without a timeout under the SpecContext", func() {
+			code := converter.GenerateGoCode(domain.TestStep{Command: "echo hello", Timeout: "0s"}, cmdCfg)
+			Expect(code).To(ContainSubstring(`cmd := exec.CommandContext(ctx, "echo", "hello")`))
+			Expect(code).ToNot(ContainSubstring("context.WithTimeout"))
+		})
+
 		It("should handle expected exit code", func() {
-			code := converter.GenerateGoCode("false", 1, "0s", 0, "", cmdCfg)
+			code := converter.GenerateGoCode(domain.TestStep{Command: "false", ExpectedExit: 1, Timeout: "0s"}, cmdCfg)
 			Expect(code).To(ContainSubstring("ExitCode"))
 			Expect(code).To(ContainSubstring("Equal(1)"))
 		})
 
 		It("should not produce retry wrapper when retry=0", func() {
-			code := converter.GenerateGoCode("echo hello", 0, "0s", 0, "", cmdCfg)
+			code := converter.GenerateGoCode(domain.TestStep{Command: "echo hello", Timeout: "0s"}, cmdCfg)
 			Expect(code).ToNot(ContainSubstring("attempt"))
 			Expect(code).ToNot(ContainSubstring("time.Sleep"))
 			Expect(code).ToNot(ContainSubstring("lastErr"))
 		})
 
 		It("should produce a retry loop with 4 attempts when retry=3", func() {
-			code := converter.GenerateGoCode("kubectl get pods", 0, "0s", 3, "2s", cmdCfg)
+			code := converter.GenerateGoCode(domain.TestStep{Command: "kubectl get pods", Timeout: "0s", RetryCount: 3, RetryInterval: "2s"}, cmdCfg)
 			Expect(code).To(ContainSubstring("attempt <= 4"))
 			Expect(code).To(ContainSubstring("time.Sleep(2 * time.Second)"))
 			Expect(code).To(ContainSubstring("lastErr"))
@@ -282,7 +402,7 @@ var _ = Describe("Converter", func() {
 
 		It("should preserve newlines in heredoc commands", func() {
 			heredocCmd := "cat <<EOF | kubectl apply -f-\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: test\nEOF"
-			code := converter.GenerateGoCode(heredocCmd, 0, "0s", 0, "", cmdCfg)
+			code := converter.GenerateGoCode(domain.TestStep{Command: heredocCmd, Timeout: "0s"}, cmdCfg)
 			Expect(code).To(ContainSubstring("/bin/sh"), "heredoc should route through shell")
 			Expect(code).To(ContainSubstring("-c"), "heredoc should use shell flag")
 			Expect(code).ToNot(ContainSubstring("&&"), "heredoc lines should not be joined with &&")
@@ -291,18 +411,18 @@ var _ = Describe("Converter", func() {
 
 		It("should still join non-heredoc multi-line commands with &&", func() {
 			multiCmd := "kubectl create ns foo\nkubectl apply -f bar.yaml"
-			code := converter.GenerateGoCode(multiCmd, 0, "0s", 0, "", cmdCfg)
-			Expect(code).To(ContainSubstring("kubectl create ns foo && kubectl apply -f bar.yaml"))
+			code := converter.GenerateGoCode(domain.TestStep{Command: multiCmd, Timeout: "0s"}, cmdCfg)
+			Expect(code).To(ContainSubstring(`"kubectl create ns foo &&\n\tkubectl apply -f bar.yaml"`))
 		})
 
 		It("should use custom retry interval", func() {
-			code := converter.GenerateGoCode("echo test", 0, "0s", 2, "5s", cmdCfg)
+			code := converter.GenerateGoCode(domain.TestStep{Command: "echo test", Timeout: "0s", RetryCount: 2, RetryInterval: "5s"}, cmdCfg)
 			Expect(code).To(ContainSubstring("attempt <= 3"))
 			Expect(code).To(ContainSubstring("time.Sleep(5 * time.Second)"))
 		})
 
 		It("should wrap retry inside timeout", func() {
-			code := converter.GenerateGoCode("kubectl get pods", 0, "60s", 3, "2s", cmdCfg)
+			code := converter.GenerateGoCode(domain.TestStep{Command: "kubectl get pods", Timeout: "60s", RetryCount: 3, RetryInterval: "2s"}, cmdCfg)
 			// Timeout should be the outermost wrapper
 			Expect(code).To(ContainSubstring("context.WithTimeout"))
 			// Retry loop should be inside
@@ -412,15 +532,1205 @@ var _ = Describe("Converter", func() {
 		})
 	})
 
-	Describe("ValidateCommand", func() {
-		It("should pass for safe commands", func() {
-			err := converter.ValidateCommand("kubectl get pods", []string{"rm -rf /"})
+	Describe("Polling with Eventually and Consistently", func() {
+		var doc *domain.ParsedDocument
+
+		BeforeEach(func() {
+			tagCfg.Attributes["eventually"] = []string{"eventually"}
+			tagCfg.Attributes["consistently"] = []string{"consistently"}
+			tagCfg.Attributes["poll"] = []string{"poll", "poll-interval"}
+			doc = &domain.ParsedDocument{
+				FilePath: "test.md",
+				FileType: "markdown",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "kubectl get pods", LineNumber: 4, Attributes: map[string]string{}},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+		})
+
+		It("should poll the step with Eventually until it passes", func() {
+			doc.Blocks[0].Attributes["eventually"] = "2m"
+			doc.Blocks[0].Attributes["poll"] = "5s"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			step := specs[0].Steps[0]
+			Expect(step.Eventually).To(Equal("2m"))
+			Expect(step.PollInterval).To(Equal("5s"))
+			Expect(step.GoCode).To(ContainSubstring("Eventually(ctx, func(g Gomega) {"))
+			Expect(step.GoCode).To(ContainSubstring("g.Expect(err).ToNot(HaveOccurred(), string(output))"))
+			Expect(step.GoCode).To(ContainSubstring("}).WithTimeout(2 * time.Minute).WithPolling(5 * time.Second).Should(Succeed())"))
+			Expect(step.GoCode).ToNot(ContainSubstring("time.Sleep"))
+		})
+
+		It("should poll the step with Consistently and default the poll interval to 2s", func() {
+			doc.Blocks[0].Attributes["consistently"] = "30s"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps[0].PollInterval).To(Equal("2s"))
+			Expect(specs[0].Steps[0].GoCode).To(ContainSubstring("}).WithTimeout(30 * time.Second).WithPolling(2 * time.Second).Should(Succeed())"))
+		})
+
+		It("should assert the output inside the polled function", func() {
+			tagCfg.OutputTags = []string{"go-e2e-output"}
+			doc.Blocks[0].Attributes["eventually"] = "1m"
+			doc.Blocks = append(doc.Blocks, domain.CodeBlock{
+				Tag: "go-e2e-output", Content: "Running", LineNumber: 8, Attributes: map[string]string{},
+			})
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps).To(HaveLen(1))
+			Expect(specs[0].Steps[0].GoCode).To(ContainSubstring(`g.Expect(strings.TrimSpace(string(output))).To(ContainSubstring("Running"))`))
+		})
+
+		It("should capture the output of the last attempt after polling", func() {
+			tagCfg.Attributes["capture"] = []string{"capture"}
+			doc.Blocks[0].Attributes["eventually"] = "1m"
+			doc.Blocks[0].Attributes["capture"] = "PODS"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			code := specs[0].Steps[0].GoCode
+			Expect(code).To(ContainSubstring("polledOutput = output"))
+			Expect(code).To(ContainSubstring(`vars["PODS"] = strings.TrimSpace(string(polledOutput))`))
+			Expect(strings.Index(code, "Should(Succeed())")).To(BeNumerically("<", strings.Index(code, `vars["PODS"]`)))
+		})
+
+		DescribeTable("should report invalid polling attributes at the block line",
+			func(attrs map[string]string, message string) {
+				doc.Blocks[0].Attributes = attrs
+				_, err := conv.Convert(doc, tagCfg)
+				Expect(err).To(HaveOccurred())
+				var dsErr *domain.DocSyncerError
+				Expect(errors.As(err, &dsErr)).To(BeTrue())
+				Expect(dsErr.LineNumber).To(Equal(4))
+				Expect(err.Error()).To(ContainSubstring(message))
+			},
+			Entry("poll alone", map[string]string{"poll": "5s"}, "poll needs an eventually or consistently attribute"),
+			Entry("both modes", map[string]string{"eventually": "1m", "consistently": "1m"}, "cannot be combined"),
+			Entry("with retry", map[string]string{"eventually": "1m", "retry": "3"}, "retry cannot be combined"),
+			Entry("bad duration", map[string]string{"eventually": "soon"}, `invalid eventually duration "soon"`),
+			Entry("zero poll", map[string]string{"consistently": "1m", "poll-interval": "0s"}, `invalid poll duration "0s"`),
+		)
+	})
+
+	Describe("Background steps", func() {
+		var doc *domain.ParsedDocument
+
+		BeforeEach(func() {
+			tagCfg.Attributes["background"] = []string{"background"}
+			tagCfg.Attributes["ready_when"] = []string{"ready-when"}
+			tagCfg.Attributes["session"] = []string{"session"}
+			tagCfg.Attributes["capture"] = []string{"capture"}
+			tagCfg.OutputTags = []string{"go-e2e-output"}
+			doc = &domain.ParsedDocument{
+				FilePath: "test.md",
+				FileType: "markdown",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "kubectl port-forward svc/web 8080:80", LineNumber: 4, Attributes: map[string]string{}},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+		})
+
+		It("should start the process and wait until its port accepts connections", func() {
+			doc.Blocks[0].Attributes["background"] = "true"
+			doc.Blocks[0].Attributes["ready-when"] = "port:8080"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			step := specs[0].Steps[0]
+			Expect(step.Background).To(BeTrue())
+			Expect(step.ReadyWhen).To(Equal("port:8080"))
+			Expect(step.GoCode).To(ContainSubstring(`cmd := exec.Command("kubectl", "port-forward", "svc/web", "8080:80")`))
+			Expect(step.GoCode).To(ContainSubstring("Expect(cmd.Start()).To(Succeed())"))
+			Expect(step.GoCode).To(ContainSubstring("syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)"))
+			Expect(step.GoCode).To(ContainSubstring(`net.DialTimeout("tcp", "localhost:8080", time.Second)`))
+			Expect(step.GoCode).ToNot(ContainSubstring("CombinedOutput"))
+		})
+
+		It("should run a command ending with & as a background step", func() {
+			doc.Blocks[0].Content = "kubectl port-forward svc/web 8080:80 &"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps[0].Background).To(BeTrue())
+			Expect(specs[0].Steps[0].Command).To(Equal("kubectl port-forward svc/web 8080:80"))
+			Expect(specs[0].Steps[0].GoCode).ToNot(ContainSubstring("Eventually"))
+		})
+
+		It("should leave && lists and session jobs alone", func() {
+			doc.Blocks[0].Content = "make build && make test"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps[0].Background).To(BeFalse())
+
+			doc.Blocks[0].Content = "minikube tunnel &"
+			doc.Blocks[0].Attributes["session"] = "persistent"
+			specs, err = conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps[0].Background).To(BeFalse())
+			Expect(specs[0].Steps[0].InSession).To(BeTrue())
+		})
+
+		It("should reject an output block after a background step", func() {
+			doc.Blocks[0].Attributes["background"] = "true"
+			doc.Blocks = append(doc.Blocks, domain.CodeBlock{
+				Tag: "go-e2e-output", Content: "Forwarding", LineNumber: 8, Attributes: map[string]string{},
+			})
+			_, err := conv.Convert(doc, tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("follows a background step"))
+		})
+
+		DescribeTable("should report invalid background attributes at the block line",
+			func(attrs map[string]string, message string) {
+				doc.Blocks[0].Attributes = attrs
+				_, err := conv.Convert(doc, tagCfg)
+				Expect(err).To(HaveOccurred())
+				var dsErr *domain.DocSyncerError
+				Expect(errors.As(err, &dsErr)).To(BeTrue())
+				Expect(dsErr.LineNumber).To(Equal(4))
+				Expect(err.Error()).To(ContainSubstring(message))
+			},
+			Entry("ready-when alone", map[string]string{"ready-when": "port:8080"}, "ready-when needs background=true"),
+			Entry("bad port", map[string]string{"background": "true", "ready-when": "port:http"}, `invalid ready-when port "http"`),
+			Entry("bad address", map[string]string{"background": "true", "ready-when": "tcp:localhost"}, "use tcp:HOST:PORT"),
+			Entry("bad regex", map[string]string{"background": "true", "ready-when": "log:("}, "invalid ready-when regex"),
+			Entry("no timeout", map[string]string{"background": "true", "ready-when": "port:8080", "timeout": "0"}, "ready-when needs a timeout"),
+			Entry("retry", map[string]string{"background": "true", "retry": "2"}, "cannot retry or poll"),
+			Entry("capture", map[string]string{"background": "true", "capture": "OUT"}, "cannot capture"),
+			Entry("session", map[string]string{"background": "true", "session": "persistent"}, "not supported in a persistent session"),
+		)
+	})
+
+	Describe("Step running time", func() {
+		DescribeTable("should bound each step for the NodeTimeout of its node",
+			func(attrs map[string]string, want time.Duration) {
+				tagCfg.Attributes["eventually"] = []string{"eventually"}
+				tagCfg.Attributes["consistently"] = []string{"consistently"}
+				doc := &domain.ParsedDocument{
+					FilePath: "test.md",
+					FileType: "markdown",
+					Blocks:   []domain.CodeBlock{{Tag: "go-e2e-step", Content: "kubectl get pods", LineNumber: 4, Attributes: attrs}},
+					Headings: []domain.Heading{},
+					Metadata: map[string]string{},
+				}
+				specs, err := conv.Convert(doc, tagCfg)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(specs[0].Steps[0].MaxDuration).To(Equal(want))
+			},
+			Entry("default timeout", map[string]string{}, 30*time.Second),
+			Entry("retries", map[string]string{"timeout": "10s", "retry": "2", "retry-interval": "5s"}, 40*time.Second),
+			Entry("eventually", map[string]string{"timeout": "10s", "eventually": "2m"}, 130*time.Second),
+			Entry("consistently", map[string]string{"timeout": "5s", "consistently": "30s"}, 35*time.Second),
+			Entry("no timeout", map[string]string{"timeout": "0"}, time.Duration(0)),
+		)
+	})
+
+	Describe("Shell command parsing", func() {
+		DescribeTable("should run plain commands without a shell",
+			func(command, call string) {
+				code := converter.GenerateGoCode(domain.TestStep{Command: command, Timeout: "0s"}, cmdCfg)
+				Expect(code).To(ContainSubstring("cmd := exec.CommandContext(ctx, " + call + ")"))
+			},
+			Entry("quoted braces", `kubectl get pods -o jsonpath='{.items[0].metadata.name}'`,
+				`"kubectl", "get", "pods", "-o", "jsonpath={.items[0].metadata.name}"`),
+			Entry("quoted operators", `echo "a > b" 'x | y'`, `"echo", "a > b", "x | y"`),
+			Entry("escaped space", `ls my\ dir`, `"ls", "my dir"`),
+			Entry("line continuation", "kubectl get pods \\\n  -n demo", `"kubectl", "get", "pods", "-n", "demo"`),
+		)
+
+		DescribeTable("should run commands needing expansion or redirection in the shell",
+			func(command string) {
+				code := converter.GenerateGoCode(domain.TestStep{Command: command, Timeout: "0s"}, cmdCfg)
+				Expect(code).To(ContainSubstring(`cmd := exec.CommandContext(ctx, "/bin/sh", "-c", `))
+			},
+			Entry("glob", "ls *.yaml"),
+			Entry("tilde", "cat ~/.kube/config"),
+			Entry("brace expansion", "mkdir -p out/{a,b}"),
+			Entry("variable", "echo $HOME"),
+			Entry("command substitution", "kubectl delete pod $(kubectl get pods -o name)"),
+			Entry("redirect", "kubectl logs web 2>&1"),
+			Entry("assignment", "KUBECONFIG=/tmp/kc kubectl get pods"),
+			Entry("pipe", "kubectl get pods | grep web"),
+		)
+
+		It("should keep compound commands intact and join statements with &&", func() {
+			command := "for ns in a b; do\n  kubectl create ns $ns\ndone\nif kubectl get ns a; then\n  echo ok\nfi"
+			code := converter.GenerateGoCode(domain.TestStep{Command: command, Timeout: "0s"}, cmdCfg)
+			Expect(code).To(ContainSubstring(`"for ns in a b; do\n\tkubectl create ns $ns\ndone &&\n\tif kubectl get ns a; then\n\t\techo ok\n\tfi"`))
+		})
+
+		It("should group || lists so that a later line does not hide an earlier failure", func() {
+			command := "false\ngrep x missing.txt || true"
+			code := converter.GenerateGoCode(domain.TestStep{Command: command, Timeout: "0s"}, cmdCfg)
+			quoted := `"false && {\n\tgrep x missing.txt || true\n}"`
+			Expect(code).To(ContainSubstring(quoted))
+
+			script, err := strconv.Unquote(quoted)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exec.Command("/bin/sh", "-c", script).Run()).To(HaveOccurred(), "the failing first line must fail the step")
+		})
+
+		It("should drop comments and keep background statements running", func() {
+			command := "# start the proxy\nkubectl proxy &\ncurl localhost:8001 # check it"
+			code := converter.GenerateGoCode(domain.TestStep{Command: command, Timeout: "0s"}, cmdCfg)
+			Expect(code).To(ContainSubstring(`"{\n\n\tkubectl proxy &\n} &&\n\tcurl localhost:8001"`))
+			Expect(code).ToNot(ContainSubstring("start the proxy"))
+		})
+
+		It("should report a command that does not parse at its line in the document", func() {
+			doc := &domain.ParsedDocument{
+				FilePath: "test.md",
+				FileType: "markdown",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "kubectl get pods\nif kubectl get ns demo; then\n  echo ok\n", LineNumber: 4, Attributes: map[string]string{}},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+			_, err := conv.Convert(doc, tagCfg)
+			var dsErr *domain.DocSyncerError
+			Expect(errors.As(err, &dsErr)).To(BeTrue())
+			Expect(dsErr.LineNumber).To(Equal(5))
+			Expect(dsErr.Message).To(ContainSubstring(`if statement must end with "fi"`))
+		})
+
+		It("should report a console command that does not parse at its prompt line", func() {
+			tagCfg.Attributes["console"] = []string{"console"}
+			doc := &domain.ParsedDocument{
+				FilePath: "test.md",
+				FileType: "markdown",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "$ kubectl get pods\nNAME\n$ echo 'oops", LineNumber: 10, Attributes: map[string]string{"console": "true"}},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+			_, err := conv.Convert(doc, tagCfg)
+			var dsErr *domain.DocSyncerError
+			Expect(errors.As(err, &dsErr)).To(BeTrue())
+			Expect(dsErr.LineNumber).To(Equal(12))
+			Expect(dsErr.Message).To(ContainSubstring("without closing quote"))
+		})
+	})
+
+	Describe("Command policy", func() {
+		check := func(cmdCfg *config.CommandConfig, file, command string) ([]domain.PolicyFinding, error) {
+			policy, err := converter.NewCommandPolicy(cmdCfg)
+			Expect(err).ToNot(HaveOccurred())
+			return policy.Check(file, command, 10, nil)
+		}
+
+		It("should compile the console prompt once, failing NewConverter when it is invalid", func() {
+			cmdCfg.ConsolePrompt = `^\$(`
+			_, err := converter.NewConverter(cmdCfg)
+			Expect(err).To(MatchError(ContainSubstring("invalid commands.console_prompt")))
+		})
+
+		It("should compile the policy once, failing NewConverter when it is invalid", func() {
+			cmdCfg.Policy.Rules = []config.PolicyRule{{Name: "bad", Regex: "(unclosed"}}
+			_, err := converter.NewConverter(cmdCfg)
+			Expect(err).To(MatchError(ContainSubstring(`invalid regex "(unclosed" in command policy rule "bad"`)))
+		})
+
+		DescribeTable("should apply the default rules to the parsed commands",
+			func(command string, denied bool) {
+				_, err := check(&config.DefaultConfig().Commands, "docs/guide.md", command)
+				if denied {
+					Expect(err).To(MatchError(ContainSubstring("command blocked by security policy")))
+				} else {
+					Expect(err).ToNot(HaveOccurred())
+				}
+			},
+			Entry("rm -rf /", "rm -rf /", true),
+			Entry("extra spaces", "rm  -rf  /", true),
+			Entry("reordered flags", "rm -fr /", true),
+			Entry("long flag and glob", "rm --recursive --force /*", true),
+			Entry("quoted root", `rm -r "/"`, true),
+			Entry("sudo", "sudo -u root rm -rf /", true),
+			Entry("sh -c", `sh -c 'rm -rf /'`, true),
+			Entry("command substitution", "echo $(rm -rf /)", true),
+			Entry("pipeline", "yes | rm -rf /", true),
+			Entry("mkfs variant", "mkfs.ext4 /dev/sdb1", true),
+			Entry("dd to a device", "dd if=/dev/zero of=/dev/sda", true),
+			Entry("redirect to a disk", "cat disk.img > /dev/sda", true),
+			Entry("mkfs as an argument", `echo "mkfs"`, false),
+			Entry("redirect in quotes", `echo "> /dev/sda"`, false),
+			Entry("redirect to a partition list", "cat /proc/partitions > /tmp/sda.txt", false),
+			Entry("rm of a sandbox", "rm -rf ./tmp/", false),
+			Entry("dd to a file", "dd if=/dev/zero of=disk.img bs=1M count=1", false),
+			Entry("kubectl", "kubectl get pods", false),
+		)
+
+		It("should report commands denied by blocked patterns at their line", func() {
+			cmdCfg := &config.CommandConfig{BlockedPatterns: []string{"rm -rf /"}}
+			_, err := check(cmdCfg, "docs/guide.md", "kubectl get pods\nrm   -rf   /")
+			var dsErr *domain.DocSyncerError
+			Expect(errors.As(err, &dsErr)).To(BeTrue())
+			Expect(dsErr.File).To(Equal("docs/guide.md"))
+			Expect(dsErr.LineNumber).To(Equal(11))
+			Expect(dsErr.Suggestion).To(ContainSubstring("commands.blocked_patterns"))
+		})
+
+		DescribeTable("should match blocked patterns as commands, not as text",
+			func(command string, denied bool) {
+				cmdCfg := &config.CommandConfig{BlockedPatterns: []string{"rm -rf /", "mkfs", "dd if=", "> /dev/sd"}}
+				_, err := check(cmdCfg, "docs/guide.md", command)
+				if denied {
+					Expect(err).To(MatchError(ContainSubstring(`matches rule "blocked_patterns"`)))
+				} else {
+					Expect(err).ToNot(HaveOccurred())
+				}
+			},
+			Entry("reordered flags", "rm -fr /", true),
+			Entry("separate flags", "sudo rm -r -f /", true),
+			Entry("command variant", "mkfs.ext4 disk.img", true),
+			Entry("operand prefix", "dd if=/dev/zero of=disk.img", true),
+			Entry("redirect", "cat disk.img >/dev/sda1", true),
+			Entry("pattern in quotes", `echo "mkfs"`, false),
+			Entry("redirect in quotes", `echo "> /dev/sda"`, false),
+			Entry("other operand", "rm -rf /tmp", false),
+			Entry("missing flag", "rm -r /", false),
+		)
+
+		It("should reject blocked patterns that are not a single command", func() {
+			_, err := converter.NewCommandPolicy(&config.CommandConfig{BlockedPatterns: []string{"a; b"}})
+			Expect(err).To(MatchError(ContainSubstring(`commands.blocked_patterns: "a; b" is not a single command`)))
+		})
+
+		It("should report warn rules and let an allow rule decide before a deny rule", func() {
+			cmdCfg := &config.CommandConfig{Policy: config.PolicyConfig{Rules: []config.PolicyRule{
+				{Name: "helm-warn", Action: "warn", Command: "helm", Message: "changes the cluster"},
+				{Name: "tmp-ok", Action: "allow", Command: "rm", Args: []string{"/tmp/demo"}},
+				{Name: "no-rm", Command: "rm"},
+			}}}
+			findings, err := check(cmdCfg, "docs/guide.md", "helm install demo ./chart\nrm -rf /tmp/demo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(findings).To(Equal([]domain.PolicyFinding{
+				{Rule: "helm-warn", Action: "warn", Command: "helm install demo ./chart", File: "docs/guide.md", Line: 10, Message: "changes the cluster"},
+				{Rule: "tmp-ok", Action: "allow", Command: "rm -rf /tmp/demo", File: "docs/guide.md", Line: 11},
+			}))
+
+			_, err = check(cmdCfg, "docs/guide.md", "rm -rf /tmp/other")
+			Expect(err).To(MatchError(ContainSubstring(`matches rule "no-rm"`)))
+		})
+
+		It("should only allow the listed binaries, also behind wrappers", func() {
+			cmdCfg := &config.CommandConfig{Policy: config.PolicyConfig{AllowedBinaries: []string{"kubectl", "env", "grep"}}}
+			_, err := check(cmdCfg, "docs/guide.md", "env KUBECONFIG=/tmp/kc kubectl get pods | grep web")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = check(cmdCfg, "docs/guide.md", "kubectl get pods\nenv NS=demo curl example.com")
+			var dsErr *domain.DocSyncerError
+			Expect(errors.As(err, &dsErr)).To(BeTrue())
+			Expect(dsErr.LineNumber).To(Equal(11))
+			Expect(dsErr.Message).To(ContainSubstring(`"curl example.com" matches rule "allowed_binaries"`))
+		})
+
+		It("should report every denied command as a finding once CollectDenied is set", func() {
+			cmdCfg := &config.CommandConfig{Policy: config.PolicyConfig{
+				AllowedBinaries: []string{"kubectl", "rm"},
+				Rules:           []config.PolicyRule{{Name: "rm-root", Command: "rm", Args: []string{"/"}}},
+			}}
+			policy, err := converter.NewCommandPolicy(cmdCfg)
+			Expect(err).ToNot(HaveOccurred())
+			policy.CollectDenied()
+
+			findings, err := policy.Check("docs/guide.md", "rm -rf /\nkubectl get pods\ncurl example.com", 10, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(findings).To(Equal([]domain.PolicyFinding{
+				{Rule: "rm-root", Action: "deny", Command: "rm -rf /", File: "docs/guide.md", Line: 10},
+				{Rule: "allowed_binaries", Action: "deny", Command: "curl example.com", File: "docs/guide.md", Line: 12,
+					Message: "curl is not an allowed binary"},
+			}))
+		})
+
+		It("should apply directory policies to the documents under their path", func() {
+			cmdCfg := &config.CommandConfig{Policy: config.PolicyConfig{
+				AllowedBinaries: []string{"kubectl"},
+				Directories: []config.DirectoryPolicy{
+					{Path: "docs/sandbox", AllowedBinaries: []string{"kubectl", "rm"}},
+					{Path: "docs/sandbox/strict", Rules: []config.PolicyRule{{Name: "no-rm", Command: "rm"}}},
+				},
+			}}
+			_, err := check(cmdCfg, "docs/sandbox/cleanup.md", "rm -rf ./out")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = check(cmdCfg, "docs/guide.md", "rm -rf ./out")
+			Expect(err).To(MatchError(ContainSubstring("allowed_binaries")))
+			_, err = check(cmdCfg, "docs/sandbox/strict/cleanup.md", "rm -rf ./out")
+			Expect(err).To(MatchError(ContainSubstring(`matches rule "no-rm"`)))
+		})
+
+		It("should let an override bypass only the rules it names", func() {
+			policy, err := converter.NewCommandPolicy(&config.CommandConfig{Policy: config.PolicyConfig{
+				AllowedBinaries: []string{"rm", "mkfs.ext4"},
+				Rules: []config.PolicyRule{
+					{Name: "no-rm", Command: "rm"},
+					{Name: "mkfs", Command: "mkfs*"},
+				},
+			}})
+			Expect(err).ToNot(HaveOccurred())
+			override := &converter.Override{Rules: []string{"no-rm", "allowed_binaries"}, Reason: "sandbox cleanup"}
+
+			findings, err := policy.Check("docs/guide.md", "rm -rf ./out\nmkdir out", 10, override)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(findings).To(Equal([]domain.PolicyFinding{
+				{Rule: "no-rm", Action: "deny", Command: "rm -rf ./out", File: "docs/guide.md", Line: 10, Override: "sandbox cleanup"},
+				{Rule: "allowed_binaries", Action: "deny", Command: "mkdir out", File: "docs/guide.md", Line: 11,
+					Message: "mkdir is not an allowed binary", Override: "sandbox cleanup"},
+			}))
+
+			_, err = policy.Check("docs/guide.md", "mkfs.ext4 disk.img", 10, override)
+			Expect(err).To(MatchError(ContainSubstring(`matches rule "mkfs"`)))
+		})
+
+		DescribeTable("should reject allow-blocked values without a rule or a reason",
+			func(value string) {
+				_, err := converter.ParseOverride(value)
+				Expect(err).To(HaveOccurred())
+			},
+			Entry("reason only", "cleanup of the sandbox"),
+			Entry("no reason", "rm-root:"),
+			Entry("no rule", ": cleanup"),
+		)
+
+		Describe("allow-blocked on a block", func() {
+			var doc *domain.ParsedDocument
+
+			BeforeEach(func() {
+				cmdCfg.AllowOverrides = true
+				tagCfg.Attributes["allow_blocked"] = []string{"allow-blocked"}
+				doc = &domain.ParsedDocument{
+					FilePath: "test.md",
+					FileType: "markdown",
+					Blocks: []domain.CodeBlock{
+						{Tag: "go-e2e-step", Content: "rm -rf /", LineNumber: 4,
+							Attributes: map[string]string{"allow-blocked": "blocked_patterns: the test runs in a throwaway container"}},
+					},
+					Headings: []domain.Heading{},
+					Metadata: map[string]string{},
+				}
+			})
+
+			It("should keep the bypassed rule and its reason on the step", func() {
+				specs, err := conv.Convert(doc, tagCfg)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(specs[0].Steps[0].PolicyFindings).To(ConsistOf(domain.PolicyFinding{
+					Rule: "blocked_patterns", Action: "deny", Command: "rm -rf /", File: "test.md", Line: 4,
+					Message: `matches "rm -rf /"`, Override: "the test runs in a throwaway container",
+				}))
+			})
+
+			It("should only apply to its own block", func() {
+				doc.Blocks = append(doc.Blocks, domain.CodeBlock{Tag: "go-e2e-step", Content: "rm -rf /", LineNumber: 8, Attributes: map[string]string{}})
+				_, err := conv.Convert(doc, tagCfg)
+				var dsErr *domain.DocSyncerError
+				Expect(errors.As(err, &dsErr)).To(BeTrue())
+				Expect(dsErr.LineNumber).To(Equal(8))
+			})
+
+			It("should fail when commands.allow_overrides is false", func() {
+				cmdCfg.AllowOverrides = false
+				_, err := conv.Convert(doc, tagCfg)
+				Expect(err).To(MatchError(ContainSubstring("allow-blocked is disabled by commands.allow_overrides")))
+			})
+
+			It("should fail when the named rule denies nothing in the block", func() {
+				doc.Blocks[0].Content = "rm -rf ./tmp"
+				_, err := conv.Convert(doc, tagCfg)
+				Expect(err).To(MatchError(ContainSubstring(`allow-blocked names rule "blocked_patterns", which denies no command of this block`)))
+			})
+		})
+
+		It("should keep the findings of a converted step", func() {
+			cmdCfg.Policy.Rules = []config.PolicyRule{{Name: "helm-warn", Action: "warn", Command: "helm"}}
+			conv, err := converter.NewConverter(cmdCfg)
+			Expect(err).ToNot(HaveOccurred())
+			doc := &domain.ParsedDocument{
+				FilePath: "test.md",
+				FileType: "markdown",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "helm list", LineNumber: 4, Attributes: map[string]string{}},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps[0].PolicyFindings).To(ConsistOf(
+				domain.PolicyFinding{Rule: "helm-warn", Action: "warn", Command: "helm list", File: "test.md", Line: 4},
+			))
+		})
+	})
+
+	Describe("Document metadata defaults", func() {
+		var doc *domain.ParsedDocument
+
+		BeforeEach(func() {
+			tagCfg.Attributes["describe"] = []string{"describe"}
+			tagCfg.Attributes["labels"] = []string{"labels"}
+			tagCfg.Attributes["skip"] = []string{"skip"}
+			doc = &domain.ParsedDocument{
+				FilePath: "test.md",
+				FileType: "markdown",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "echo one", Attributes: map[string]string{}},
+					{Tag: "go-e2e-step", Content: "echo two", Attributes: map[string]string{"timeout": "10s"}},
+				},
+				Headings: []domain.Heading{{Level: 1, Text: "Heading Title", Line: 1}},
+				Metadata: map[string]string{
+					"describe": "From front matter",
+					"labels":   "istio, smoke",
+					"template": "custom",
+					"timeout":  "2m",
+				},
+			}
+		})
+
+		It("should apply document defaults to the TestSpec", func() {
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs).To(HaveLen(1))
+			Expect(specs[0].DescribeBlock).To(Equal("From front matter"))
+			Expect(specs[0].Labels).To(Equal([]string{"istio", "smoke"}))
+			Expect(specs[0].TemplateName).To(Equal("custom"))
+			Expect(specs[0].Skip).To(BeEmpty())
+		})
+
+		It("should use the document timeout unless a block sets its own", func() {
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps[0].Timeout).To(Equal("2m"))
+			Expect(specs[0].Steps[1].Timeout).To(Equal("10s"))
+		})
+
+		It("should let block template attributes override the document template", func() {
+			doc.Blocks[1].Attributes["template"] = "block_template"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].TemplateName).To(Equal("block_template"))
+		})
+
+		It("should keep TestFile names ahead of the document describe", func() {
+			doc.Blocks[0].TestFile = "My Test"
+			doc.Blocks[1].TestFile = "My Test"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].DescribeBlock).To(Equal("My Test"))
+		})
+
+		DescribeTable("should resolve the skip reason",
+			func(value, expected string) {
+				doc.Metadata["skip"] = value
+				specs, err := conv.Convert(doc, tagCfg)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(specs[0].Skip).To(Equal(expected))
+			},
+			Entry("true", "true", "skipped by document metadata"),
+			Entry("false", "false", ""),
+			Entry("reason", "requires a GPU node", "requires a GPU node"),
+		)
+	})
+
+	Describe("Console session blocks", func() {
+		var doc *domain.ParsedDocument
+
+		BeforeEach(func() {
+			tagCfg.Attributes["console"] = []string{"console"}
+			doc = &domain.ParsedDocument{
+				FilePath: "test.md",
+				FileType: "markdown",
+				Blocks: []domain.CodeBlock{
+					{
+						Tag: "go-e2e-step",
+						Content: "Sample session:\n" +
+							"$ kubectl get pods \\\n" +
+							">   -n demo\n" +
+							"NAME    READY   STATUS\n" +
+							"web-1   1/1     Running\n" +
+							"\n" +
+							"$ kubectl get svc -n demo\n" +
+							"NAME   TYPE\n" +
+							"web    ClusterIP",
+						LineNumber: 10,
+						Attributes: map[string]string{"console": "true", "step-name": "Inspect demo"},
+					},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+		})
+
+		It("should turn each prompt line into a step with its output", func() {
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			steps := specs[0].Steps
+			Expect(steps).To(HaveLen(2))
+			Expect(steps[0].Command).To(Equal("kubectl get pods -n demo"))
+			Expect(steps[0].ExpectedOutput).To(Equal("NAME    READY   STATUS\nweb-1   1/1     Running"))
+			Expect(steps[0].Name).To(Equal("Inspect demo (1/2)"))
+			Expect(steps[0].LineNumber).To(Equal(11))
+			Expect(steps[1].Command).To(Equal("kubectl get svc -n demo"))
+			Expect(steps[1].ExpectedOutput).To(Equal("NAME   TYPE\nweb    ClusterIP"))
+			Expect(steps[1].LineNumber).To(Equal(16))
+			Expect(steps[1].GoCode).ToNot(ContainSubstring("NAME"))
+		})
+
+		It("should leave blocks without the console attribute unchanged", func() {
+			delete(doc.Blocks[0].Attributes, "console")
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps).To(HaveLen(1))
+			Expect(specs[0].Steps[0].ExpectedOutput).To(BeEmpty())
+		})
+
+		It("should report console blocks without prompt lines", func() {
+			doc.Blocks[0].Content = "kubectl get pods"
+			_, err := conv.Convert(doc, tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("console_prompt"))
+		})
+	})
+
+	Describe("Companion output blocks", func() {
+		var doc *domain.ParsedDocument
+
+		BeforeEach(func() {
+			tagCfg.OutputTags = []string{"go-e2e-output"}
+			tagCfg.Attributes["match"] = []string{"match"}
+			doc = &domain.ParsedDocument{
+				FilePath: "test.md",
+				FileType: "markdown",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "kubectl get ns demo", LineNumber: 3, Attributes: map[string]string{}},
+					{Tag: "go-e2e-output", Content: "demo   Active", LineNumber: 7, Attributes: map[string]string{}},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+		})
+
+		It("should attach the output to the preceding step", func() {
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps).To(HaveLen(1))
+			step := specs[0].Steps[0]
+			Expect(step.ExpectedOutput).To(Equal("demo   Active"))
+			Expect(step.OutputMatch).To(Equal("contains"))
+			Expect(step.GoCode).To(ContainSubstring(`Expect(strings.TrimSpace(string(output))).To(ContainSubstring("demo   Active"))`))
+		})
+
+		It("should reject output blocks that do not follow a step", func() {
+			doc.Blocks = doc.Blocks[1:]
+			_, err := conv.Convert(doc, tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("test.md:7"))
+			Expect(err.Error()).To(ContainSubstring("does not follow a step"))
+		})
+
+		It("should reject unknown match modes", func() {
+			doc.Blocks[1].Attributes["match"] = "fuzzy"
+			_, err := conv.Convert(doc, tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("fuzzy"))
+		})
+
+		It("should reject an invalid regex at its file and line", func() {
+			doc.Blocks[1].Attributes["match"] = "regex"
+			doc.Blocks[1].Content = "demo +(Active"
+			_, err := conv.Convert(doc, tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("test.md:7"))
+			Expect(err.Error()).To(ContainSubstring("invalid match=regex output"))
+		})
+
+		It("should reject an invalid regex in console session output", func() {
+			tagCfg.Attributes["console"] = []string{"console"}
+			doc.Blocks = []domain.CodeBlock{
+				{Tag: "go-e2e-step", Content: "$ echo '[x'\n[x", LineNumber: 4, Attributes: map[string]string{"console": "true", "match": "regex"}},
+			}
+			_, err := conv.Convert(doc, tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("test.md:4"))
+			Expect(err.Error()).To(ContainSubstring("invalid match=regex output"))
+		})
+
+		It("should assert console session output when a match mode is set", func() {
+			tagCfg.Attributes["console"] = []string{"console"}
+			doc.Blocks = []domain.CodeBlock{
+				{Tag: "go-e2e-step", Content: "$ echo hi\nhi", Attributes: map[string]string{"console": "true", "match": "exact"}},
+			}
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps[0].GoCode).To(ContainSubstring(`To(Equal("hi"))`))
+		})
+	})
+
+	Describe("Output assertions in GenerateGoCode", func() {
+		It("should emit exact, contains and regex matchers", func() {
+			step := domain.TestStep{Command: "echo hello", Timeout: "0s", ExpectedOutput: "  hello\n", OutputMatch: "exact"}
+			Expect(converter.GenerateGoCode(step, cmdCfg)).To(ContainSubstring(`Expect(strings.TrimSpace(string(output))).To(Equal("hello"))`))
+
+			step.OutputMatch = "contains"
+			Expect(converter.GenerateGoCode(step, cmdCfg)).To(ContainSubstring(`To(ContainSubstring("hello"))`))
+
+			step.ExpectedOutput = `^hel+o$`
+			step.OutputMatch = "regex"
+			Expect(converter.GenerateGoCode(step, cmdCfg)).To(ContainSubstring(`To(MatchRegexp("^hel+o$"))`))
+		})
+
+		It("should compare lines in any order for the lines mode", func() {
+			step := domain.TestStep{Command: "kubectl get ns", Timeout: "0s", ExpectedOutput: "default\n\nkube-system  \n", OutputMatch: "lines"}
+			code := converter.GenerateGoCode(step, cmdCfg)
+			Expect(code).To(ContainSubstring(`strings.Split(string(output), "\n")`))
+			Expect(code).To(ContainSubstring(`Expect(outputLines).To(ConsistOf("default", "kube-system"), string(output))`))
+		})
+
+		It("should honor the configured whitespace normalization", func() {
+			cmdCfg.OutputWhitespace = "collapse"
+			step := domain.TestStep{Command: "echo hello", Timeout: "0s", ExpectedOutput: "a   b\n c", OutputMatch: "exact"}
+			Expect(converter.GenerateGoCode(step, cmdCfg)).To(ContainSubstring(`Expect(strings.Join(strings.Fields(string(output)), " ")).To(Equal("a b c"))`))
+
+			cmdCfg.OutputWhitespace = "none"
+			Expect(converter.GenerateGoCode(step, cmdCfg)).To(ContainSubstring(`Expect(string(output)).To(Equal("a   b\n c"))`))
+		})
+
+		It("should assert the last attempt's output after a retry loop", func() {
+			step := domain.TestStep{Command: "echo hello", Timeout: "0s", RetryCount: 2, RetryInterval: "1s", ExpectedOutput: "hello", OutputMatch: "exact"}
+			code := converter.GenerateGoCode(step, cmdCfg)
+			Expect(code).To(ContainSubstring(`Expect(strings.TrimSpace(string(lastOutput))).To(Equal("hello"))`))
+			Expect(strings.Index(code, "string(lastOutput))).To(Equal")).To(BeNumerically(">", strings.Index(code, "for attempt")))
+		})
+	})
+
+	Describe("Structured output assertions", func() {
+		var doc *domain.ParsedDocument
+
+		BeforeEach(func() {
+			tagCfg.Attributes["expect_json"] = []string{"expect-json"}
+			tagCfg.Attributes["expect_jsonpath"] = []string{"expect-jsonpath"}
+			tagCfg.Attributes["expect_yaml"] = []string{"expect-yaml"}
+			doc = &domain.ParsedDocument{
+				FilePath: "test.md",
+				FileType: "markdown",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "kubectl get pod web -o json", LineNumber: 12, Attributes: map[string]string{}},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+		})
+
+		It("should generate field checks for jq and JSONPath expressions", func() {
+			doc.Blocks[0].Attributes["expect-json"] = `.status.phase == "Running"`
+			doc.Blocks[0].Attributes["expect-jsonpath"] = `{.spec.containers[0]['name']}=web`
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			step := specs[0].Steps[0]
+			Expect(step.StructuredAssertions).To(HaveLen(2))
+			Expect(step.GoCode).To(ContainSubstring(`json.Unmarshal(output, &doc)`))
+			Expect(step.GoCode).To(ContainSubstring(`[]interface{}{"status", "phase"}`))
+			Expect(step.GoCode).To(ContainSubstring(`Expect(val).To(Equal("Running")`))
+			Expect(step.GoCode).To(ContainSubstring(`[]interface{}{"spec", "containers", 0, "name"}`))
+			Expect(step.GoCode).To(ContainSubstring(`Expect(val).To(Equal("web")`))
+		})
+
+		It("should decode YAML output for expect-yaml", func() {
+			doc.Blocks[0].Attributes["expect-yaml"] = `.spec.replicas >= 2`
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps[0].GoCode).To(ContainSubstring(`yaml.Unmarshal(output, &doc)`))
+			Expect(specs[0].Steps[0].GoCode).To(ContainSubstring(`Expect(val).To(BeNumerically(">=", 2)`))
+		})
+
+		DescribeTable("should compare values by type",
+			func(expr, matcher string) {
+				doc.Blocks[0].Attributes["expect-json"] = expr
+				specs, err := conv.Convert(doc, tagCfg)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(specs[0].Steps[0].GoCode).To(ContainSubstring(matcher))
+			},
+			Entry("number", `.spec.replicas == 3`, `To(BeNumerically("==", 3)`),
+			Entry("not equal", `.status.phase != "Failed"`, `ToNot(Equal("Failed")`),
+			Entry("bool", `.spec.paused == false`, `To(Equal(false)`),
+			Entry("null", `.metadata.deletionTimestamp == null`, `To(BeNil()`),
+			Entry("truthy", `.status.ready`, `ToNot(Or(BeNil(), Equal(false))`),
+			Entry("quoted key", `.metadata.labels["app.kubernetes.io/name"] == "web"`, `{"metadata", "labels", "app.kubernetes.io/name"}`),
+		)
+
+		DescribeTable("should report invalid expressions at the block line",
+			func(attr, expr, message string) {
+				doc.Blocks[0].Attributes[attr] = expr
+				_, err := conv.Convert(doc, tagCfg)
+				Expect(err).To(HaveOccurred())
+				var dsErr *domain.DocSyncerError
+				Expect(errors.As(err, &dsErr)).To(BeTrue())
+				Expect(dsErr.LineNumber).To(Equal(12))
+				Expect(err.Error()).To(ContainSubstring(message))
+			},
+			Entry("unquoted string", "expect-json", `.status.phase == Running`, "not a JSON literal"),
+			Entry("missing dot", "expect-json", `status.phase == "Running"`, "must start with '.'"),
+			Entry("ordering a string", "expect-json", `.status.phase > "A"`, "needs a number"),
+			Entry("negative index", "expect-json", `.items[-1].name`, "unsupported index"),
+			Entry("jsonpath without braces", "expect-jsonpath", `.spec.replicas=3`, "wrapped in braces"),
+			Entry("jsonpath bad operator", "expect-jsonpath", `{.spec.replicas}>3`, "expected =, == or !="),
+		)
+	})
+
+	Describe("Captured variables", func() {
+		var doc *domain.ParsedDocument
+
+		BeforeEach(func() {
+			tagCfg.Attributes["capture"] = []string{"capture"}
+			tagCfg.Attributes["capture_regex"] = []string{"capture-regex"}
+			tagCfg.Attributes["capture_jsonpath"] = []string{"capture-jsonpath"}
+			doc = &domain.ParsedDocument{
+				FilePath: "test.md",
+				FileType: "markdown",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "kubectl get pod -o name", LineNumber: 5, Attributes: map[string]string{"capture": "POD"}},
+					{Tag: "go-e2e-step", Content: "kubectl logs ${POD} --tail=${LINES}", LineNumber: 9, Attributes: map[string]string{}},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+		})
+
+		It("should store the trimmed output and pass it to later steps", func() {
+			specs, err := conv.Convert(doc, tagCfg)
 			Expect(err).ToNot(HaveOccurred())
+			Expect(specs).To(HaveLen(1))
+			Expect(specs[0].Steps[0].CaptureVar).To(Equal("POD"))
+			Expect(specs[0].Steps[0].GoCode).To(ContainSubstring(`vars["POD"] = strings.TrimSpace(string(output))`))
+
+			// ${LINES} is not captured anywhere, so it is left to the shell environment
+			consumer := specs[0].Steps[1]
+			Expect(consumer.UsesVars).To(Equal([]string{"POD"}))
+			Expect(consumer.GoCode).To(ContainSubstring(`"-c", "kubectl logs ${POD} --tail=${LINES}")`))
+			Expect(consumer.GoCode).To(ContainSubstring(`cmd.Env = append(os.Environ(), "POD="+vars["POD"])`))
+			Expect(strings.Index(consumer.GoCode, "cmd.Env")).To(BeNumerically("<", strings.Index(consumer.GoCode, "cmd.CombinedOutput()")))
 		})
 
-		It("should block dangerous commands", func() {
-			err := converter.ValidateCommand("rm -rf /", []string{"rm -rf /"})
+		It("should capture a regex group", func() {
+			doc.Blocks[0].Attributes["capture-regex"] = `pod/(\S+)`
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps[0].GoCode).To(ContainSubstring(`regexp.MustCompile("pod/(\\S+)").FindStringSubmatch(string(output))`))
+			Expect(specs[0].Steps[0].GoCode).To(ContainSubstring(`vars["POD"] = strings.TrimSpace(m[1])`))
+		})
+
+		It("should capture a JSONPath value", func() {
+			doc.Blocks[0].Attributes["capture-jsonpath"] = `{.items[0].metadata.name}`
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps[0].GoCode).To(ContainSubstring(`[]interface{}{"items", 0, "metadata", "name"}`))
+			Expect(specs[0].Steps[0].GoCode).To(ContainSubstring(`vars["POD"] = strings.TrimSpace(fmt.Sprint(val))`))
+		})
+
+		It("should capture after retries succeed", func() {
+			doc.Blocks[0].Attributes["retry"] = "3"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			code := specs[0].Steps[0].GoCode
+			Expect(strings.Index(code, `vars["POD"]`)).To(BeNumerically(">", strings.Index(code, "for attempt")))
+		})
+
+		It("should reject a reference before the capturing step", func() {
+			doc.Blocks[0], doc.Blocks[1] = doc.Blocks[1], doc.Blocks[0]
+			_, err := conv.Convert(doc, tagCfg)
+			Expect(err).To(HaveOccurred())
+			var dsErr *domain.DocSyncerError
+			Expect(errors.As(err, &dsErr)).To(BeTrue())
+			Expect(dsErr.LineNumber).To(Equal(9))
+			Expect(err.Error()).To(ContainSubstring("${POD} is not captured by an earlier step"))
+		})
+
+		It("should reject a reference to a variable captured in another test", func() {
+			doc.Blocks[1].StepGroup = "logs"
+			_, err := conv.Convert(doc, tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("${POD} is not captured"))
+		})
+
+		DescribeTable("should report invalid capture attributes at the block line",
+			func(attrs map[string]string, message string) {
+				doc.Blocks[0].Attributes = attrs
+				doc.Blocks = doc.Blocks[:1]
+				_, err := conv.Convert(doc, tagCfg)
+				Expect(err).To(HaveOccurred())
+				var dsErr *domain.DocSyncerError
+				Expect(errors.As(err, &dsErr)).To(BeTrue())
+				Expect(dsErr.LineNumber).To(Equal(5))
+				Expect(err.Error()).To(ContainSubstring(message))
+			},
+			Entry("invalid name", map[string]string{"capture": "pod-name"}, "invalid capture variable name"),
+			Entry("invalid regex", map[string]string{"capture": "POD", "capture-regex": "pod/(("}, "invalid capture-regex"),
+			Entry("regex and jsonpath", map[string]string{"capture": "POD", "capture-regex": "x", "capture-jsonpath": "{.a}"}, "not both"),
+			Entry("jsonpath comparison", map[string]string{"capture": "POD", "capture-jsonpath": "{.a}=b"}, "without comparison"),
+			Entry("regex without capture", map[string]string{"capture-regex": "x"}, "need a capture=NAME"),
+		)
+	})
+
+	Describe("Persistent shell sessions", func() {
+		var doc *domain.ParsedDocument
+
+		BeforeEach(func() {
+			tagCfg.Attributes["session"] = []string{"session"}
+			doc = &domain.ParsedDocument{
+				FilePath: "test.md",
+				FileType: "markdown",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "cd /tmp", LineNumber: 3, Attributes: map[string]string{}},
+					{Tag: "go-e2e-step", Content: "ls", LineNumber: 7, Attributes: map[string]string{"expected": "2"}},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+		})
+
+		It("should run steps in isolated processes by default", func() {
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].SessionCode).To(BeEmpty())
+			Expect(specs[0].Steps[0].InSession).To(BeFalse())
+			Expect(specs[0].Steps[0].GoCode).To(ContainSubstring("exec.Command"))
+		})
+
+		It("should feed every step of the It block to one shell when a block sets session=persistent", func() {
+			doc.Blocks[1].Attributes["session"] = "persistent"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].SessionCode).To(ContainSubstring(`shell = exec.Command("/bin/sh")`))
+			Expect(specs[0].SessionCode).To(ContainSubstring("runInShell := func(command string, env []string, timeout time.Duration) ([]byte, int, error)"))
+
+			Expect(specs[0].Steps[0].InSession).To(BeTrue())
+			Expect(specs[0].Steps[0].GoCode).To(ContainSubstring(`output, exitCode, err := runInShell("cd /tmp", nil, 30 * time.Second)`))
+			Expect(specs[0].Steps[0].GoCode).ToNot(ContainSubstring("exec.Command"))
+			Expect(specs[0].Steps[1].GoCode).To(ContainSubstring(`Expect(exitCode).To(Equal(2), string(output))`))
+		})
+
+		It("should use commands.session as the default", func() {
+			cmdCfg.Session = "persistent"
+			doc.Blocks[0].Attributes["timeout"] = "0"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].SessionCode).ToNot(BeEmpty())
+			Expect(specs[0].Steps[0].GoCode).To(ContainSubstring(`runInShell("cd /tmp", nil, 0)`))
+		})
+
+		It("should retry until the expected exit code and export captured variables", func() {
+			tagCfg.Attributes["capture"] = []string{"capture"}
+			doc.Blocks[0].Attributes["session"] = "persistent"
+			doc.Blocks[0].Attributes["capture"] = "DIR"
+			doc.Blocks[1].Content = "ls ${DIR}"
+			doc.Blocks[1].Attributes["retry"] = "2"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			code := specs[0].Steps[1].GoCode
+			Expect(code).To(ContainSubstring(`lastOutput, lastCode, lastErr = runInShell("ls ${DIR}", []string{"DIR="+vars["DIR"]}, 30 * time.Second)`))
+			Expect(code).To(ContainSubstring("if lastErr == nil && lastCode == 2 {"))
+			Expect(code).To(ContainSubstring("Expect(lastCode).To(Equal(2), string(lastOutput))"))
+		})
+
+		It("should restart the shell after a step timeout and retry a timed-out attempt", func() {
+			doc.Blocks[0].Attributes["session"] = "persistent"
+			doc.Blocks[1].Attributes["retry"] = "1"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].SessionCode).To(MatchRegexp(`case <-expired:\s+syscall.Kill\(-shell.Process.Pid, syscall.SIGKILL\)\s+shell.Wait\(\)\s+if err := startShell\(\); err != nil`))
+			Expect(specs[0].SessionCode).To(ContainSubstring("the shell session was restarted"))
+
+			// The error of an attempt is only asserted once the retries are exhausted
+			code := specs[0].Steps[1].GoCode
+			Expect(strings.Index(code, "Expect(lastErr).ToNot(HaveOccurred()")).To(BeNumerically(">", strings.Index(code, "time.Sleep(")))
+		})
+
+		It("should reject conflicting session modes in one It block", func() {
+			doc.Blocks[0].Attributes["session"] = "persistent"
+			doc.Blocks[1].Attributes["session"] = "isolated"
+			_, err := conv.Convert(doc, tagCfg)
+			Expect(err).To(HaveOccurred())
+			var dsErr *domain.DocSyncerError
+			Expect(errors.As(err, &dsErr)).To(BeTrue())
+			Expect(dsErr.LineNumber).To(Equal(7))
+			Expect(err.Error()).To(ContainSubstring("conflicts with session=persistent"))
+		})
+
+		It("should keep session modes of separate It blocks apart", func() {
+			doc.Blocks[0].Attributes["session"] = "persistent"
+			doc.Blocks[1].StepGroup = "other"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs).To(HaveLen(2))
+			Expect(specs[0].SessionCode).ToNot(BeEmpty())
+			Expect(specs[1].SessionCode).To(BeEmpty())
+		})
+
+		It("should reject an unknown session mode", func() {
+			doc.Blocks[0].Attributes["session"] = "shared"
+			_, err := conv.Convert(doc, tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(`unknown session mode "shared"`))
+		})
+	})
+
+	Describe("Environment, working directory and stdin attributes", func() {
+		var doc *domain.ParsedDocument
+
+		BeforeEach(func() {
+			tagCfg.Attributes["env"] = []string{"env"}
+			tagCfg.Attributes["workdir"] = []string{"workdir", "dir"}
+			tagCfg.Attributes["stdin"] = []string{"stdin"}
+			tagCfg.Attributes["session"] = []string{"session"}
+			doc = &domain.ParsedDocument{
+				FilePath: "test.md",
+				FileType: "markdown",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "kubectl apply -f app.yaml", LineNumber: 4, Attributes: map[string]string{}},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+		})
+
+		It("should resolve env, workdir and inline stdin into the step", func() {
+			doc.Blocks[0].Attributes["env"] = "KUBECONFIG=/tmp/kc, NS=demo"
+			doc.Blocks[0].Attributes["dir"] = "examples/bookinfo"
+			doc.Blocks[0].Attributes["stdin"] = `y\ny`
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			step := specs[0].Steps[0]
+			Expect(step.Env).To(Equal([]string{"KUBECONFIG=/tmp/kc", "NS=demo"}))
+			Expect(step.Dir).To(Equal("examples/bookinfo"))
+			Expect(step.Stdin).To(Equal("y\ny\n"))
+			Expect(step.GoCode).To(ContainSubstring(`cmd.Env = append(os.Environ(), "KUBECONFIG=/tmp/kc", "NS=demo")`))
+		})
+
+		It("should read stdin from a file relative to workdir", func() {
+			doc.Blocks[0].Attributes["workdir"] = "examples/bookinfo"
+			doc.Blocks[0].Attributes["stdin"] = "@input.yaml"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps[0].StdinFile).To(Equal("examples/bookinfo/input.yaml"))
+			Expect(specs[0].Steps[0].Stdin).To(BeEmpty())
+		})
+
+		It("should combine step env with captured variables", func() {
+			tagCfg.Attributes["capture"] = []string{"capture"}
+			doc.Blocks[0].Attributes["capture"] = "POD"
+			doc.Blocks = append(doc.Blocks, domain.CodeBlock{
+				Tag: "go-e2e-step", Content: "kubectl logs ${POD}", LineNumber: 8, Attributes: map[string]string{"env": "NS=demo"},
+			})
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps[1].GoCode).To(ContainSubstring(`cmd.Env = append(os.Environ(), "NS=demo", "POD="+vars["POD"])`))
+		})
+
+		DescribeTable("should report invalid attributes at the block line",
+			func(attrs map[string]string, message string) {
+				doc.Blocks[0].Attributes = attrs
+				_, err := conv.Convert(doc, tagCfg)
+				Expect(err).To(HaveOccurred())
+				var dsErr *domain.DocSyncerError
+				Expect(errors.As(err, &dsErr)).To(BeTrue())
+				Expect(dsErr.LineNumber).To(Equal(4))
+				Expect(err.Error()).To(ContainSubstring(message))
+			},
+			Entry("env without value", map[string]string{"env": "NS"}, "invalid env entry"),
+			Entry("env with bad name", map[string]string{"env": "MY-VAR=1"}, "invalid env entry"),
+			Entry("stdin file without path", map[string]string{"stdin": "@"}, "needs a file path"),
+			Entry("persistent session", map[string]string{"session": "persistent", "workdir": "x"}, "not supported in a persistent session"),
+		)
+	})
+
+	Describe("Setup and cleanup phases", func() {
+		var doc *domain.ParsedDocument
+
+		BeforeEach(func() {
+			tagCfg.Attributes["phase"] = []string{"phase"}
+			doc = &domain.ParsedDocument{
+				FilePath: "test.md",
+				FileType: "markdown",
+				Blocks: []domain.CodeBlock{
+					{Tag: "go-e2e-step", Content: "kubectl create ns demo", LineNumber: 3, Attributes: map[string]string{"phase": "setup"}},
+					{Tag: "go-e2e-step", Content: "kubectl apply -f app.yaml", LineNumber: 7, Attributes: map[string]string{}},
+					{Tag: "go-e2e-step", Content: "kubectl get pods", LineNumber: 11, Attributes: map[string]string{}, StepGroup: "inspect"},
+					{Tag: "go-e2e-step", Content: "kubectl delete ns demo", LineNumber: 15, Attributes: map[string]string{"phase": "cleanup"}},
+				},
+				Headings: []domain.Heading{},
+				Metadata: map[string]string{},
+			}
+		})
+
+		It("should move phase blocks out of the It blocks and share them across the Describe", func() {
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs).To(HaveLen(2))
+			for _, spec := range specs {
+				Expect(spec.Steps).To(HaveLen(1))
+				Expect(spec.SetupSteps).To(HaveLen(1))
+				Expect(spec.SetupSteps[0].Command).To(Equal("kubectl create ns demo"))
+				Expect(spec.CleanupSteps).To(HaveLen(1))
+				Expect(spec.CleanupSteps[0].Command).To(Equal("kubectl delete ns demo"))
+				Expect(spec.BeforeAllSteps).To(BeEmpty())
+			}
+		})
+
+		It("should collect before-all and after-all blocks", func() {
+			doc.Blocks[0].Attributes["phase"] = "before-all"
+			doc.Blocks[3].Attributes["phase"] = "after-all"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].BeforeAllSteps).To(HaveLen(1))
+			Expect(specs[0].AfterAllSteps).To(HaveLen(1))
+			Expect(specs[0].SetupSteps).To(BeEmpty())
+		})
+
+		It("should attach an output block to the phase step before it", func() {
+			tagCfg.OutputTags = []string{"go-e2e-output"}
+			doc.Blocks = append(doc.Blocks[:1], append([]domain.CodeBlock{
+				{Tag: "go-e2e-output", Content: "namespace/demo created", LineNumber: 5, Attributes: map[string]string{}},
+			}, doc.Blocks[1:]...)...)
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].SetupSteps[0].ExpectedOutput).To(Equal("namespace/demo created"))
+			Expect(specs[0].Steps[0].ExpectedOutput).To(BeEmpty())
+		})
+
+		It("should run phase steps in their own process in a persistent session", func() {
+			tagCfg.Attributes["session"] = []string{"session"}
+			doc.Blocks[1].Attributes["session"] = "persistent"
+			specs, err := conv.Convert(doc, tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(specs[0].Steps[0].InSession).To(BeTrue())
+			Expect(specs[0].SetupSteps[0].InSession).To(BeFalse())
+			Expect(specs[0].SetupSteps[0].GoCode).To(ContainSubstring("exec.Command"))
+		})
+
+		It("should reject an unknown phase", func() {
+			doc.Blocks[0].Attributes["phase"] = "teardown"
+			_, err := conv.Convert(doc, tagCfg)
+			Expect(err).To(HaveOccurred())
+			var dsErr *domain.DocSyncerError
+			Expect(errors.As(err, &dsErr)).To(BeTrue())
+			Expect(dsErr.LineNumber).To(Equal(3))
+			Expect(err.Error()).To(ContainSubstring(`unknown phase "teardown"`))
+		})
+
+		It("should reject captures in phase blocks", func() {
+			tagCfg.Attributes["capture"] = []string{"capture"}
+			doc.Blocks[0].Attributes["capture"] = "NS"
+			_, err := conv.Convert(doc, tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("capture is not supported on setup blocks"))
+		})
+
+		It("should reject a test with only phase blocks", func() {
+			doc.Blocks = []domain.CodeBlock{doc.Blocks[0], doc.Blocks[3]}
+			_, err := conv.Convert(doc, tagCfg)
 			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("no test step to run around"))
 		})
 	})
 })
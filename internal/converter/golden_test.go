@@ -0,0 +1,76 @@
+package converter_test
+
+import (
+	"flag"
+	"go/format"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/converter"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
+)
+
+// update rewrites the golden files: go test ./internal/converter/ -update
+var update = flag.Bool("update", false, "update golden files in testdata/golden")
+
+var _ = Describe("Golden step code", func() {
+	cmdCfg := &config.CommandConfig{
+		DefaultTimeout:   "30s",
+		Shell:            "/bin/sh",
+		ShellFlag:        "-c",
+		OutputWhitespace: "trim",
+	}
+
+	// The generated statements are compared after go/format, which accepts a
+	// list of statements, so the golden files stay readable
+	DescribeTable("should match the golden file",
+		func(name string, step domain.TestStep) {
+			code, err := format.Source([]byte(converter.GenerateGoCode(step, cmdCfg) + "\n"))
+			Expect(err).ToNot(HaveOccurred())
+
+			path := filepath.Join("..", "..", "testdata", "golden", name+".golden")
+			if *update {
+				Expect(os.WriteFile(path, code, 0644)).To(Succeed())
+			}
+			want, err := os.ReadFile(path)
+			Expect(err).ToNot(HaveOccurred(), "run go test ./internal/converter/ -update to create it")
+			Expect(string(code)).To(Equal(string(want)))
+		},
+		Entry("skip-on-failure", "skip-on-failure",
+			domain.TestStep{Name: "Check helm", Command: "helm version", SkipOnFailure: true}),
+		Entry("skip-on-failure with retries", "skip-on-failure-retry",
+			domain.TestStep{Name: "Check helm", Command: "helm version", SkipOnFailure: true, RetryCount: 2, RetryInterval: "1s"}),
+		Entry("skip-on-failure with timeout", "skip-on-failure-timeout",
+			domain.TestStep{Name: "Check helm", Command: "helm version", SkipOnFailure: true, Timeout: "10s"}),
+		Entry("continue-on-error", "continue-on-error",
+			domain.TestStep{Name: "Delete old release", Command: "helm uninstall demo", ContinueOnError: true}),
+		Entry("continue-on-error with retries, timeout and exit code", "continue-on-error-retry-timeout",
+			domain.TestStep{Name: "Wait", Command: "kubectl wait --for=condition=Ready pod/web", ContinueOnError: true,
+				RetryCount: 3, RetryInterval: "2s", Timeout: "1m", ExpectedExit: 1}),
+		Entry("continue-on-error with output assertion", "continue-on-error-output",
+			domain.TestStep{Name: "Status", Command: "kubectl get ns demo", ContinueOnError: true,
+				ExpectedOutput: "Active", OutputMatch: converter.MatchContains}),
+		Entry("continue-on-error in a persistent session", "continue-on-error-session",
+			domain.TestStep{Name: "Stop", Command: "make stop", ContinueOnError: true, InSession: true, Timeout: "5s"}),
+		Entry("eventually with output assertion and timeout", "eventually-output",
+			domain.TestStep{Name: "Wait for pod", Command: "kubectl get pod web", Eventually: "2m", PollInterval: "5s",
+				ExpectedOutput: "Running", OutputMatch: converter.MatchContains, Timeout: "10s"}),
+		Entry("eventually with capture and skip-on-failure", "eventually-capture",
+			domain.TestStep{Name: "Find pod", Command: "kubectl get pods -o name", Eventually: "1m", PollInterval: "2s",
+				CaptureVar: "POD", CaptureRegex: `pod/(\S+)`, SkipOnFailure: true}),
+		Entry("consistently with expected exit code", "consistently-exit",
+			domain.TestStep{Name: "Stays absent", Command: "kubectl get ns old", Consistently: "30s", PollInterval: "5s", ExpectedExit: 1}),
+		Entry("background step waiting for a log line", "background-log",
+			domain.TestStep{Name: "Tunnel", Command: "minikube tunnel", Background: true, ReadyWhen: "log:Starting tunnel", Timeout: "1m"}),
+		Entry("background step with a port check, env and skip-on-failure", "background-port",
+			domain.TestStep{Name: "Port-forward", Command: "kubectl port-forward svc/web 8080:80 | tee pf.log", Background: true,
+				ReadyWhen: "port:8080", Timeout: "30s", Env: []string{"KUBECONFIG=/tmp/kc"}, SkipOnFailure: true}),
+		Entry("eventually in a persistent session", "eventually-session",
+			domain.TestStep{Name: "Ready", Command: "make ready", Eventually: "1m", PollInterval: "1s", InSession: true,
+				StructuredAssertions: []domain.StructuredAssertion{{Format: "json", Syntax: converter.SyntaxJQ, Expr: ".ready == true"}}}),
+	)
+})
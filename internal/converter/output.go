@@ -0,0 +1,125 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
+)
+
+// Output match modes for TestStep.OutputMatch.
+const (
+	MatchExact    = "exact"    // normalized output equals the expected output
+	MatchContains = "contains" // normalized output contains the expected output
+	MatchRegex    = "regex"    // normalized output matches the expected output as a regex
+	MatchLines    = "lines"    // output lines equal the expected lines in any order
+)
+
+// Whitespace normalization modes for CommandConfig.OutputWhitespace.
+const (
+	WhitespaceNone     = "none"     // compare output as printed
+	WhitespaceTrim     = "trim"     // trim surrounding whitespace (each line in lines mode)
+	WhitespaceCollapse = "collapse" // collapse every whitespace run into a single space
+)
+
+// validMatchModes lists the supported output match modes.
+var validMatchModes = []string{MatchExact, MatchContains, MatchRegex, MatchLines}
+
+// isValidMatchMode reports whether mode is a supported output match mode.
+func isValidMatchMode(mode string) bool {
+	for _, m := range validMatchModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// outputAssertion generates the Gomega assertions on the command output held
+// in the []byte variable outputVar: the expected output match followed by the
+// structured field checks. It returns an empty string when the step has none.
+func outputAssertion(step domain.TestStep, outputVar string, cmdCfg *config.CommandConfig) string {
+	var parts []string
+	if m := outputMatchAssertion(step, outputVar, cmdCfg); m != "" {
+		parts = append(parts, m)
+	}
+	for _, a := range step.StructuredAssertions {
+		parts = append(parts, structuredAssertionCode(a, outputVar))
+	}
+	return strings.Join(parts, "\n\t\t\t")
+}
+
+// checkOutputRegex reports an expected output of a match=regex step that is not
+// a valid regular expression, which MatchRegexp would only reject at test time.
+func checkOutputRegex(step domain.TestStep) error {
+	if step.OutputMatch != MatchRegex {
+		return nil
+	}
+	expected := strings.TrimSpace(step.ExpectedOutput)
+	if _, err := regexp.Compile(expected); err != nil {
+		return fmt.Errorf("invalid match=regex output %q: %v", expected, err)
+	}
+	return nil
+}
+
+// outputMatchAssertion generates the assertion comparing the output with the
+// step's ExpectedOutput according to its OutputMatch mode.
+func outputMatchAssertion(step domain.TestStep, outputVar string, cmdCfg *config.CommandConfig) string {
+	if step.OutputMatch == "" {
+		return ""
+	}
+	ws := cmdCfg.OutputWhitespace
+	if ws == "" {
+		ws = WhitespaceTrim
+	}
+	actual := normalizeExpr(fmt.Sprintf("string(%s)", outputVar), ws)
+
+	switch step.OutputMatch {
+	case MatchExact:
+		return fmt.Sprintf("Expect(%s).To(Equal(%q))", actual, normalizeOutput(step.ExpectedOutput, ws))
+	case MatchContains:
+		return fmt.Sprintf("Expect(%s).To(ContainSubstring(%q))", actual, normalizeOutput(step.ExpectedOutput, ws))
+	case MatchRegex:
+		return fmt.Sprintf("Expect(%s).To(MatchRegexp(%q))", actual, strings.TrimSpace(step.ExpectedOutput))
+	case MatchLines:
+		var expected []string
+		for _, l := range strings.Split(step.ExpectedOutput, "\n") {
+			if l = normalizeOutput(l, ws); l != "" {
+				expected = append(expected, fmt.Sprintf("%q", l))
+			}
+		}
+		return fmt.Sprintf(`outputLines := []string{}
+			for _, line := range strings.Split(string(%s), "\n") {
+				if l := %s; l != "" {
+					outputLines = append(outputLines, l)
+				}
+			}
+			Expect(outputLines).To(ConsistOf(%s), string(%s))`, outputVar, normalizeExpr("line", ws), strings.Join(expected, ", "), outputVar)
+	}
+	return ""
+}
+
+// normalizeOutput applies whitespace normalization to expected output at generation time.
+func normalizeOutput(s, ws string) string {
+	switch ws {
+	case WhitespaceTrim:
+		return strings.TrimSpace(s)
+	case WhitespaceCollapse:
+		return strings.Join(strings.Fields(s), " ")
+	}
+	return s
+}
+
+// normalizeExpr returns the Go expression applying whitespace normalization to
+// the string expression expr in the generated test.
+func normalizeExpr(expr, ws string) string {
+	switch ws {
+	case WhitespaceTrim:
+		return fmt.Sprintf("strings.TrimSpace(%s)", expr)
+	case WhitespaceCollapse:
+		return fmt.Sprintf(`strings.Join(strings.Fields(%s), " ")`, expr)
+	}
+	return expr
+}
@@ -0,0 +1,118 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
+)
+
+// Phases for the phase attribute, placing a block outside the It blocks.
+const (
+	PhaseStep      = "step"       // a regular step of its It block (default)
+	PhaseSetup     = "setup"      // BeforeEach: runs before every It block
+	PhaseCleanup   = "cleanup"    // DeferCleanup: runs after every It block, even when a step fails
+	PhaseBeforeAll = "before-all" // BeforeAll: runs once before the It blocks (Ordered)
+	PhaseAfterAll  = "after-all"  // AfterAll: runs once after the It blocks and their cleanup (Ordered)
+)
+
+// validPhases lists the accepted phase values.
+var validPhases = []string{PhaseStep, PhaseSetup, PhaseCleanup, PhaseBeforeAll, PhaseAfterAll}
+
+// phaseSteps holds the steps of the setup and cleanup phases of a Describe block.
+type phaseSteps struct {
+	setup, cleanup, beforeAll, afterAll []domain.TestStep
+}
+
+// list returns the step list of phase, or nil for an unknown phase.
+func (p *phaseSteps) list(phase string) *[]domain.TestStep {
+	switch phase {
+	case PhaseSetup:
+		return &p.setup
+	case PhaseCleanup:
+		return &p.cleanup
+	case PhaseBeforeAll:
+		return &p.beforeAll
+	case PhaseAfterAll:
+		return &p.afterAll
+	}
+	return nil
+}
+
+// empty reports whether no block was assigned to a phase.
+func (p *phaseSteps) empty() bool {
+	return len(p.setup)+len(p.cleanup)+len(p.beforeAll)+len(p.afterAll) == 0
+}
+
+// splitPhases takes the blocks with a setup or cleanup phase out of the blocks
+// of a Describe block and converts them into phase steps, together with the
+// output blocks that follow them. It returns the remaining test step blocks.
+//
+// Phase steps always run in their own process: they are outside the It blocks,
+// so they cannot use a persistent session or captured variables.
+func (c *DefaultConverter) splitPhases(doc *domain.ParsedDocument, blocks []domain.CodeBlock, tagCfg *config.TagConfig, defaults docDefaults, docCaptures map[string]bool) (phaseSteps, []domain.CodeBlock, error) {
+	var phases phaseSteps
+	var rest []domain.CodeBlock
+
+	isolated := defaults
+	isolated.session = SessionIsolated
+
+	// last is the phase list of the previous block when it was a phase step
+	// block; prevOutput marks a previous output block consumed here
+	var last *[]domain.TestStep
+	prevOutput := false
+	for i, block := range blocks {
+		if isOutputTag(block.Tag, tagCfg) && (last != nil || prevOutput) {
+			var step *domain.TestStep
+			if last != nil {
+				step = &(*last)[len(*last)-1]
+			}
+			if err := c.attachOutput(doc, step, block, tagCfg); err != nil {
+				return phases, nil, err
+			}
+			last, prevOutput = nil, true
+			continue
+		}
+		last, prevOutput = nil, false
+
+		phase := resolveAttribute(block.Attributes, tagCfg.Attributes["phase"])
+		if phase == "" || phase == PhaseStep || isOutputTag(block.Tag, tagCfg) {
+			rest = append(rest, block)
+			continue
+		}
+
+		list := phases.list(phase)
+		if list == nil {
+			return phases, nil, domain.NewErrorWithSuggestion("convert", blockFile(doc, block), block.LineNumber,
+				fmt.Sprintf("unknown phase %q", phase),
+				"use one of: "+strings.Join(validPhases, ", "), nil)
+		}
+		if resolveAttribute(block.Attributes, tagCfg.Attributes["capture"]) != "" {
+			return phases, nil, domain.NewErrorWithSuggestion("convert", blockFile(doc, block), block.LineNumber,
+				fmt.Sprintf("capture is not supported on %s blocks", phase),
+				"captured variables belong to one test — capture in a regular step instead", nil)
+		}
+
+		steps, err := c.blockSteps(doc, block, i, tagCfg, isolated)
+		if err != nil {
+			return phases, nil, err
+		}
+		for _, step := range steps {
+			if refs := referencedVars(step.Command, docCaptures); len(refs) > 0 {
+				return phases, nil, domain.NewErrorWithSuggestion("convert", blockFile(doc, block), step.LineNumber,
+					fmt.Sprintf("${%s} is not available in %s blocks", refs[0], phase),
+					"captured variables belong to one test — use them in regular steps only", nil)
+			}
+		}
+		*list = append(*list, steps...)
+		last = list
+	}
+
+	if len(rest) == 0 && !phases.empty() {
+		return phases, nil, domain.NewErrorWithSuggestion("convert", blockFile(doc, blocks[0]), blocks[0].LineNumber,
+			"setup and cleanup blocks have no test step to run around",
+			"add at least one regular step block to this test", nil)
+	}
+	return phases, rest, nil
+}
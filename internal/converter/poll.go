@@ -0,0 +1,104 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
+)
+
+// defaultPollInterval is the time between attempts of a polled step without a
+// poll attribute, matching the default retry interval.
+const defaultPollInterval = "2s"
+
+// resolvePolling reads the eventually, consistently and poll attributes of a
+// block into step. eventually=2m polls the step until it passes within 2m;
+// consistently=30s polls it for 30s and fails as soon as an attempt fails.
+func resolvePolling(step *domain.TestStep, block domain.CodeBlock, tagCfg *config.TagConfig) error {
+	eventually := resolveAttribute(block.Attributes, tagCfg.Attributes["eventually"])
+	consistently := resolveAttribute(block.Attributes, tagCfg.Attributes["consistently"])
+	poll := resolveAttribute(block.Attributes, tagCfg.Attributes["poll"])
+
+	if eventually == "" && consistently == "" {
+		if poll != "" {
+			return fmt.Errorf("poll needs an eventually or consistently attribute")
+		}
+		return nil
+	}
+	if eventually != "" && consistently != "" {
+		return fmt.Errorf("eventually and consistently cannot be combined — choose one")
+	}
+	if step.RetryCount > 0 {
+		return fmt.Errorf("retry cannot be combined with eventually or consistently — polling already repeats the step")
+	}
+	if poll == "" {
+		poll = defaultPollInterval
+	}
+
+	for _, d := range []struct{ attr, val string }{
+		{"eventually", eventually}, {"consistently", consistently}, {"poll", poll},
+	} {
+		if d.val == "" {
+			continue
+		}
+		if dur, err := time.ParseDuration(d.val); err != nil || dur <= 0 {
+			return fmt.Errorf("invalid %s duration %q — use a positive duration such as 30s or 2m", d.attr, d.val)
+		}
+	}
+
+	step.Eventually = eventually
+	step.Consistently = consistently
+	step.PollInterval = poll
+	return nil
+}
+
+// isPolled reports whether the step runs under Eventually or Consistently.
+func isPolled(step domain.TestStep) bool {
+	return step.Eventually != "" || step.Consistently != ""
+}
+
+// wrapWithPolling runs the step code, which holds the command and its exit code
+// and output assertions, as the polled function of Eventually or Consistently.
+// Polling stops when the node's SpecContext ends. The capture of the output, if
+// any, uses the last attempt once polling ends.
+func wrapWithPolling(goCode string, step domain.TestStep) string {
+	fn, within := "Eventually", step.Eventually
+	if step.Consistently != "" {
+		fn, within = "Consistently", step.Consistently
+	}
+	poll := step.PollInterval
+	if poll == "" {
+		poll = defaultPollInterval
+	}
+
+	capture := captureCode(step, "polledOutput")
+	if capture == "" {
+		return fmt.Sprintf(`%s(ctx, func(g Gomega) {
+				%s
+			}).WithTimeout(%s).WithPolling(%s).Should(Succeed())`, fn, pollAssertions(goCode), formatDuration(within), formatDuration(poll))
+	}
+
+	return fmt.Sprintf(`{
+			var polledOutput []byte
+			%s(ctx, func(g Gomega) {
+				%s
+				polledOutput = output
+			}).WithTimeout(%s).WithPolling(%s).Should(Succeed())
+			%s
+		}`, fn, pollAssertions(goCode), formatDuration(within), formatDuration(poll), capture)
+}
+
+// pollAssertions makes the assertions of step code use the Gomega g of the
+// polled function, so a failed attempt is polled again instead of failing the spec.
+func pollAssertions(goCode string) string {
+	lines := strings.Split(goCode, "\n")
+	for i, l := range lines {
+		trimmed := strings.TrimLeft(l, " \t")
+		if strings.HasPrefix(trimmed, "Expect(") {
+			lines[i] = l[:len(l)-len(trimmed)] + "g." + trimmed
+		}
+	}
+	return strings.Join(lines, "\n")
+}
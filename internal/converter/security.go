@@ -2,15 +2,586 @@ package converter
 
 import (
 	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
+)
+
+// Actions of command policy rules.
+const (
+	ActionDeny  = "deny"
+	ActionWarn  = "warn"
+	ActionAllow = "allow"
+)
+
+// Rule names of findings that do not come from commands.policy rules.
+const (
+	ruleAllowedBinaries = "allowed_binaries"
+	ruleBlockedPatterns = "blocked_patterns"
 )
 
-// ValidateCommand checks if a command matches any blocked patterns.
-func ValidateCommand(command string, blockedPatterns []string) error {
-	for _, pattern := range blockedPatterns {
-		if strings.Contains(command, pattern) {
-			return fmt.Errorf("command blocked by security policy: contains %q — if this is intentional, remove it from commands.blocked_patterns in docsyncer.yaml", pattern)
+// CommandPolicy decides which commands step blocks may run, from
+// commands.policy and the legacy commands.blocked_patterns.
+type CommandPolicy struct {
+	global        policyScope
+	directories   []directoryScope // longest path first
+	collectDenied bool             // report denied commands as findings instead of failing
+}
+
+// policyScope is the allow-list and rules of the whole project or of a directory.
+type policyScope struct {
+	allowed []string
+	rules   []policyRule
+}
+
+type directoryScope struct {
+	dir string // absolute path
+	policyScope
+}
+
+type policyRule struct {
+	config.PolicyRule
+	regex   *regexp.Regexp
+	pattern *blockedPattern // set instead of the matchers for blocked patterns
+}
+
+// NewCommandPolicy compiles the command policy of cmdCfg. Blocked patterns
+// become deny rules checked after the policy rules.
+func NewCommandPolicy(cmdCfg *config.CommandConfig) (*CommandPolicy, error) {
+	p := &CommandPolicy{}
+	var err error
+	if p.global, err = newPolicyScope(cmdCfg.Policy.AllowedBinaries, cmdCfg.Policy.Rules); err != nil {
+		return nil, err
+	}
+	for _, pattern := range cmdCfg.BlockedPatterns {
+		bp, err := parseBlockedPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		p.global.rules = append(p.global.rules, policyRule{
+			PolicyRule: config.PolicyRule{Name: ruleBlockedPatterns, Message: fmt.Sprintf("matches %q", pattern)},
+			pattern:    bp,
+		})
+	}
+	for _, d := range cmdCfg.Policy.Directories {
+		dir, err := filepath.Abs(d.Path)
+		if err != nil {
+			return nil, fmt.Errorf("commands.policy.directories: %w", err)
+		}
+		scope, err := newPolicyScope(d.AllowedBinaries, d.Rules)
+		if err != nil {
+			return nil, err
+		}
+		p.directories = append(p.directories, directoryScope{dir: dir, policyScope: scope})
+	}
+	sort.SliceStable(p.directories, func(i, j int) bool {
+		return len(p.directories[i].dir) > len(p.directories[j].dir)
+	})
+	return p, nil
+}
+
+func newPolicyScope(allowed []string, rules []config.PolicyRule) (policyScope, error) {
+	scope := policyScope{allowed: allowed}
+	for _, r := range rules {
+		rule := policyRule{PolicyRule: r}
+		if r.Regex != "" {
+			re, err := regexp.Compile(r.Regex)
+			if err != nil {
+				return scope, fmt.Errorf("invalid regex %q in command policy rule %q: %w", r.Regex, rule.name(), err)
+			}
+			rule.regex = re
+		}
+		scope.rules = append(scope.rules, rule)
+	}
+	return scope, nil
+}
+
+// Override lets the commands of one block bypass deny rules, with the
+// justification given in the block's allow-blocked attribute.
+type Override struct {
+	Rules  []string
+	Reason string
+}
+
+// ParseOverride reads an allow-blocked value: the names of the rules to
+// bypass, separated by commas, a colon and the reason.
+func ParseOverride(value string) (*Override, error) {
+	names, reason, ok := strings.Cut(value, ":")
+	reason = strings.TrimSpace(reason)
+	if !ok || reason == "" {
+		return nil, fmt.Errorf("allow-blocked needs the rule to bypass and a reason, e.g. allow-blocked=\"rm-root: removes the sandbox created above\" (got %q)", value)
+	}
+	o := &Override{Reason: reason}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			o.Rules = append(o.Rules, name)
+		}
+	}
+	if len(o.Rules) == 0 {
+		return nil, fmt.Errorf("allow-blocked names no rule before the colon (got %q)", value)
+	}
+	return o, nil
+}
+
+// bypasses reports whether the override covers the rule.
+func (o *Override) bypasses(rule string) bool {
+	return o != nil && slices.Contains(o.Rules, rule)
+}
+
+// Check applies the policy to command, whose first line is line firstLine of
+// file. It returns the findings of the warn and allow rules that matched and
+// of the deny rules bypassed by override, which may be nil, and a
+// DocSyncerError at the line of the first denied command. Once CollectDenied
+// is set, denied commands are findings too and Check does not fail on them.
+func (p *CommandPolicy) Check(file, command string, firstLine int, override *Override) ([]domain.PolicyFinding, error) {
+	cmds, err := policyCommands(command)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := p.scopesFor(file)
+	var allowed []string
+	for _, s := range scopes {
+		if len(s.allowed) > 0 {
+			allowed = s.allowed
+			break
+		}
+	}
+
+	var findings []domain.PolicyFinding
+	for _, cmd := range cmds {
+		finding := domain.PolicyFinding{Command: cmd.text, File: file, Line: firstLine + cmd.line - 1}
+		decided := false
+	rules:
+		for _, s := range scopes {
+			for _, r := range s.rules {
+				if !r.matches(cmd) {
+					continue
+				}
+				finding.Rule, finding.Action, finding.Message = r.name(), r.action(), r.Message
+				switch {
+				case finding.Action == ActionDeny && override.bypasses(finding.Rule):
+					finding.Override = override.Reason
+					findings = append(findings, finding)
+				case finding.Action == ActionDeny && p.collectDenied:
+					findings = append(findings, finding)
+					decided = true
+					break rules
+				case finding.Action == ActionDeny:
+					return findings, policyError(finding)
+				case finding.Action == ActionAllow:
+					findings = append(findings, finding)
+					decided = true
+					break rules
+				default:
+					findings = append(findings, finding)
+				}
+			}
+		}
+
+		if !decided && len(allowed) > 0 && !matchesAny(allowed, cmd.name()) {
+			finding.Rule, finding.Action = ruleAllowedBinaries, ActionDeny
+			finding.Message = fmt.Sprintf("%s is not an allowed binary", cmd.name())
+			switch {
+			case override.bypasses(ruleAllowedBinaries):
+				finding.Override = override.Reason
+			case !p.collectDenied:
+				return findings, policyError(finding)
+			}
+			findings = append(findings, finding)
+		}
+	}
+	return findings, nil
+}
+
+// CollectDenied makes Check report denied commands as findings, without an
+// Override, instead of failing on the first one: an audit lists them all.
+func (p *CommandPolicy) CollectDenied() {
+	p.collectDenied = true
+}
+
+// scopesFor returns the scopes applying to file: the directory policies
+// containing it, most specific first, then the global one.
+func (p *CommandPolicy) scopesFor(file string) []policyScope {
+	var scopes []policyScope
+	if abs, err := filepath.Abs(file); err == nil {
+		for _, d := range p.directories {
+			if abs == d.dir || strings.HasPrefix(abs, d.dir+string(filepath.Separator)) {
+				scopes = append(scopes, d.policyScope)
+			}
+		}
+	}
+	return append(scopes, p.global)
+}
+
+// policyError reports a denied command at its line in the document.
+func policyError(f domain.PolicyFinding) error {
+	fix := "change the rule in commands.policy.rules"
+	switch f.Rule {
+	case ruleAllowedBinaries:
+		fix = "add it to commands.policy.allowed_binaries"
+	case ruleBlockedPatterns:
+		fix = "remove it from commands.blocked_patterns"
+	}
+	suggestion := fmt.Sprintf("if this is intentional, %s in docsyncer.yaml, or justify it on this block with allow-blocked=\"%s: <reason>\"", fix, f.Rule)
+	msg := fmt.Sprintf("command blocked by security policy: %q matches rule %q", f.Command, f.Rule)
+	if f.Message != "" {
+		msg += " — " + f.Message
+	}
+	return domain.NewErrorWithSuggestion("convert", f.File, f.Line, msg, suggestion, nil)
+}
+
+func (r policyRule) name() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	if r.Command != "" {
+		return r.Command
+	}
+	return r.Regex
+}
+
+func (r policyRule) action() string {
+	if r.Action == "" {
+		return ActionDeny
+	}
+	return r.Action
+}
+
+// matches reports whether all conditions set on the rule hold for cmd.
+func (r policyRule) matches(cmd policyCommand) bool {
+	if r.pattern != nil {
+		return r.pattern.matches(cmd)
+	}
+	if r.Command != "" {
+		if ok, _ := path.Match(r.Command, cmd.name()); !ok {
+			return false
+		}
+	}
+
+	flags, operands := cmd.options()
+	for _, f := range r.Flags {
+		if !slices.ContainsFunc(strings.Split(f, "|"), func(alt string) bool { return flags[alt] }) {
+			return false
+		}
+	}
+	if len(r.Args) > 0 && !slices.ContainsFunc(operands, func(op string) bool {
+		return slices.ContainsFunc(r.Args, func(arg string) bool { return op == arg || path.Clean(op) == path.Clean(arg) })
+	}) {
+		return false
+	}
+	if len(r.Redirects) > 0 && !slices.ContainsFunc(cmd.redirects, func(target string) bool { return matchesAny(r.Redirects, target) }) {
+		return false
+	}
+
+	return r.regex == nil || r.regex.MatchString(cmd.text)
+}
+
+// blockedPattern is an entry of commands.blocked_patterns, read as a command.
+// A command matches when it has all the parts of the pattern: its name, also
+// with a suffix such as mkfs.ext4, its flags and its operands, where one
+// ending in "=" such as "if=" is a prefix, and the redirects to targets
+// starting with the pattern's, such as "> /dev/sd". Words in quotes are
+// operands, never a command name or a redirect.
+type blockedPattern struct {
+	name      string
+	flags     map[string]bool
+	operands  []string
+	redirects []string
+}
+
+// parseBlockedPattern parses a blocked pattern like a command.
+func parseBlockedPattern(pattern string) (*blockedPattern, error) {
+	f, err := parseShell(pattern)
+	if err != nil || len(f.Stmts) != 1 {
+		return nil, fmt.Errorf("commands.blocked_patterns: %q is not a single command", pattern)
+	}
+	stmt := f.Stmts[0]
+	bp := &blockedPattern{redirects: outputTargets(stmt.Redirs)}
+	if call, ok := stmt.Cmd.(*syntax.CallExpr); ok && len(call.Args) > 0 {
+		cmd := policyCommand{words: make([]string, len(call.Args))}
+		for i, w := range call.Args {
+			cmd.words[i] = wordText(w)
+		}
+		bp.name = cmd.name()
+		bp.flags, bp.operands = cmd.options()
+	} else if stmt.Cmd != nil || len(bp.redirects) == 0 {
+		return nil, fmt.Errorf("commands.blocked_patterns: %q is not a single command", pattern)
+	}
+	return bp, nil
+}
+
+func (bp *blockedPattern) matches(cmd policyCommand) bool {
+	if bp.name != "" && cmd.name() != bp.name && !strings.HasPrefix(cmd.name(), bp.name+".") {
+		return false
+	}
+
+	flags, operands := cmd.options()
+	for f := range bp.flags {
+		if !flags[f] {
+			return false
+		}
+	}
+	for _, want := range bp.operands {
+		if !slices.ContainsFunc(operands, func(op string) bool {
+			if strings.HasSuffix(want, "=") {
+				return strings.HasPrefix(op, want)
+			}
+			return op == want || path.Clean(op) == path.Clean(want)
+		}) {
+			return false
+		}
+	}
+	for _, want := range bp.redirects {
+		if !slices.ContainsFunc(cmd.redirects, func(target string) bool { return strings.HasPrefix(target, want) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAny reports whether name matches one of the globs.
+func matchesAny(globs []string, name string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CommandBinaries returns the commands command invokes, as the policy sees
+// them, in order of first use: those of pipelines, substitutions, sh -c
+// scripts and behind wrappers such as sudo included.
+func CommandBinaries(command string) []string {
+	cmds, _ := policyCommands(command)
+	var names []string
+	for _, c := range cmds {
+		if !slices.Contains(names, c.words[0]) {
+			names = append(names, c.words[0])
+		}
+	}
+	return names
+}
+
+// policyCommand is a simple command as the policy sees it.
+type policyCommand struct {
+	words     []string // literal words after quote removal, other words as written
+	redirects []string // targets of the output redirects
+	text      string   // the words separated by single spaces, then the redirects
+	line      int      // line within the step's command
+}
+
+// name returns the command name without its directory.
+func (c policyCommand) name() string {
+	return path.Base(c.words[0])
+}
+
+// options splits the arguments of c into flags and operands. Combined short
+// flags such as -rf count as -r and -f, and --name=value as --name.
+func (c policyCommand) options() (map[string]bool, []string) {
+	flags := make(map[string]bool)
+	var operands []string
+	endOfOptions := false
+	for _, w := range c.words[1:] {
+		switch {
+		case endOfOptions || w == "-" || !strings.HasPrefix(w, "-"):
+			operands = append(operands, w)
+		case w == "--":
+			endOfOptions = true
+		case strings.HasPrefix(w, "--"):
+			name, _, _ := strings.Cut(w, "=")
+			flags[name] = true
+		default:
+			for _, r := range w[1:] {
+				flags["-"+string(r)] = true
+			}
+		}
+	}
+	return flags, operands
+}
+
+// policyCommands returns the simple commands of command: those of lists,
+// pipelines, compound commands and substitutions, the scripts run by sh -c and
+// eval, and the commands run by wrappers such as sudo, env or xargs.
+func policyCommands(command string) ([]policyCommand, error) {
+	f, err := parseShell(command)
+	if err != nil {
+		return nil, err
+	}
+
+	var cmds []policyCommand
+	syntax.Walk(f, func(node syntax.Node) bool {
+		stmt, ok := node.(*syntax.Stmt)
+		if !ok {
+			return true
+		}
+		call, ok := stmt.Cmd.(*syntax.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+
+		words := make([]string, len(call.Args))
+		for i, w := range call.Args {
+			words[i] = wordText(w)
+		}
+		var redirs []string
+		for _, r := range stmt.Redirs {
+			redirs = append(redirs, redirText(r))
+		}
+		targets := outputTargets(stmt.Redirs)
+		line := int(stmt.Pos().Line())
+
+		for _, ws := range unwrapCommand(words) {
+			text := strings.Join(append(slices.Clone(ws), redirs...), " ")
+			cmds = append(cmds, policyCommand{words: ws, redirects: targets, text: text, line: line})
+			// A script that does not parse is left to fail when it runs
+			if script, ok := inlineScript(ws); ok {
+				if inner, err := policyCommands(script); err == nil {
+					for _, c := range inner {
+						c.line = line
+						cmds = append(cmds, c)
+					}
+				}
+			}
+		}
+		return true
+	})
+	return cmds, nil
+}
+
+// wordText returns the value of a literal word, else the word as written
+// without its double quotes.
+func wordText(word *syntax.Word) string {
+	if lit, ok := wordLiteral(word); ok {
+		return lit
+	}
+	var b strings.Builder
+	printer := syntax.NewPrinter()
+	for _, part := range word.Parts {
+		if dq, ok := part.(*syntax.DblQuoted); ok && !dq.Dollar {
+			for _, qp := range dq.Parts {
+				printer.Print(&b, qp)
+			}
+			continue
+		}
+		printer.Print(&b, part)
+	}
+	return b.String()
+}
+
+// redirText formats a redirect as "2> file"; a heredoc's body is left out.
+func redirText(r *syntax.Redirect) string {
+	var fd string
+	if r.N != nil {
+		fd = r.N.Value
+	}
+	return fmt.Sprintf("%s%s %s", fd, r.Op, wordText(r.Word))
+}
+
+// outputTargets returns the targets of the redirects writing to a file.
+func outputTargets(redirs []*syntax.Redirect) []string {
+	var targets []string
+	for _, r := range redirs {
+		switch r.Op {
+		case syntax.RdrOut, syntax.AppOut, syntax.ClbOut, syntax.RdrAll, syntax.AppAll, syntax.RdrInOut:
+			targets = append(targets, wordText(r.Word))
+		}
+	}
+	return targets
+}
+
+// commandWrapper is a command that runs the command given as its arguments.
+type commandWrapper struct {
+	valueFlags string // short options taking the next word as value
+	positional int    // arguments before the command, e.g. the duration of timeout
+}
+
+var commandWrappers = map[string]commandWrapper{
+	"sudo":    {valueFlags: "ugCDhpRrtU"},
+	"doas":    {valueFlags: "uC"},
+	"env":     {valueFlags: "uCS"},
+	"nice":    {valueFlags: "n"},
+	"nohup":   {},
+	"time":    {valueFlags: "fo"},
+	"timeout": {valueFlags: "sk", positional: 1},
+	"command": {},
+	"exec":    {valueFlags: "a"},
+	"xargs":   {valueFlags: "aEdILnPs"},
+	"watch":   {valueFlags: "nd"},
+	"stdbuf":  {valueFlags: "ioe"},
+	"chroot":  {positional: 1},
+}
+
+// unwrapCommand returns words followed by the commands run by the wrappers
+// words starts with, e.g. rm -rf / for sudo -u root rm -rf /.
+func unwrapCommand(words []string) [][]string {
+	cmds := [][]string{words}
+	for {
+		name := path.Base(words[0])
+		w, ok := commandWrappers[name]
+		if !ok {
+			return cmds
+		}
+
+		rest := words[1:]
+		for len(rest) > 0 {
+			arg := rest[0]
+			if arg == "--" {
+				rest = rest[1:]
+				break
+			}
+			if name == "env" && !strings.HasPrefix(arg, "-") && strings.Contains(arg, "=") {
+				rest = rest[1:]
+				continue
+			}
+			if !strings.HasPrefix(arg, "-") || arg == "-" {
+				break
+			}
+			rest = rest[1:]
+			if len(arg) == 2 && strings.ContainsRune(w.valueFlags, rune(arg[1])) && len(rest) > 0 {
+				rest = rest[1:]
+			}
+		}
+		if len(rest) <= w.positional {
+			return cmds
+		}
+		words = rest[w.positional:]
+		cmds = append(cmds, words)
+	}
+}
+
+// shells are the commands whose -c argument is a script.
+var shells = map[string]bool{"sh": true, "bash": true, "dash": true, "zsh": true, "ksh": true, "ash": true}
+
+// inlineScript returns the script run by sh -c SCRIPT or eval ARGS.
+func inlineScript(words []string) (string, bool) {
+	name := path.Base(words[0])
+	if name == "eval" && len(words) > 1 {
+		return strings.Join(words[1:], " "), true
+	}
+	if !shells[name] {
+		return "", false
+	}
+	for i := 1; i < len(words)-1; i++ {
+		arg := words[i]
+		switch {
+		case arg == "-o" || arg == "+o":
+			i++
+		case strings.HasPrefix(arg, "--"):
+		case strings.HasPrefix(arg, "-") && strings.ContainsRune(arg[1:], 'c'):
+			return words[i+1], true
+		case !strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "+"):
+			return "", false
 		}
 	}
-	return nil
+	return "", false
 }
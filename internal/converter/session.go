@@ -0,0 +1,217 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
+)
+
+// Session modes for commands.session and the session attribute.
+const (
+	SessionIsolated   = "isolated"   // each step runs in its own process (default)
+	SessionPersistent = "persistent" // all steps of an It block share one shell
+)
+
+// validSessionModes lists the accepted session modes.
+var validSessionModes = []string{SessionIsolated, SessionPersistent}
+
+// isValidSessionMode reports whether mode is a known session mode.
+func isValidSessionMode(mode string) bool {
+	for _, m := range validSessionModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// groupSession resolves the session mode of an It block. Any block of the group
+// may set the session attribute; conflicting values are an error.
+func groupSession(doc *domain.ParsedDocument, blocks []domain.CodeBlock, tagCfg *config.TagConfig, def string) (string, error) {
+	if !isValidSessionMode(def) {
+		return "", domain.NewErrorWithSuggestion("convert", doc.FilePath, 0,
+			fmt.Sprintf("unknown session mode %q", def),
+			"use one of: "+strings.Join(validSessionModes, ", "), nil)
+	}
+
+	mode, setBy := def, -1
+	for i, block := range blocks {
+		val := resolveAttribute(block.Attributes, tagCfg.Attributes["session"])
+		if val == "" {
+			continue
+		}
+		if !isValidSessionMode(val) {
+			return "", domain.NewErrorWithSuggestion("convert", blockFile(doc, block), block.LineNumber,
+				fmt.Sprintf("unknown session mode %q", val),
+				"use one of: "+strings.Join(validSessionModes, ", "), nil)
+		}
+		if setBy >= 0 && val != mode {
+			return "", domain.NewErrorWithSuggestion("convert", blockFile(doc, block), block.LineNumber,
+				fmt.Sprintf("session=%s conflicts with session=%s set at line %d", val, mode, blocks[setBy].LineNumber),
+				"the session mode applies to the whole test — set it once", nil)
+		}
+		mode, setBy = val, i
+	}
+	return mode, nil
+}
+
+// sessionSetupCode generates the Go code placed at the top of an It block that
+// starts a persistent shell and defines runInShell, which feeds one step to it.
+//
+// Each step runs as a { ... } group reading stdin from /dev/null, so cd, export
+// and shell functions persist while the command cannot consume the script. A
+// marker line printed after the group carries the exit status and ends the
+// step's output. The shell runs in its own process group: a step exceeding its
+// timeout, or the end of the It block's SpecContext, kills the whole group. After
+// a timeout a new shell is started, so retries, polling and the next steps still
+// run, without the working directory and exports of the killed one.
+func sessionSetupCode(cmdCfg *config.CommandConfig) string {
+	return strings.Replace(sessionSetupTemplate, "SHELL", fmt.Sprintf("%q", cmdCfg.Shell), 1)
+}
+
+const sessionSetupTemplate = `var shell *exec.Cmd
+			var shellIn interface {
+				Write(p []byte) (int, error)
+				Close() error
+			}
+			var shellReader *bufio.Reader
+			startShell := func() error {
+				shell = exec.Command(SHELL)
+				shell.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+				in, err := shell.StdinPipe()
+				if err != nil {
+					return err
+				}
+				out, err := shell.StdoutPipe()
+				if err != nil {
+					return err
+				}
+				shell.Stderr = shell.Stdout
+				if err := shell.Start(); err != nil {
+					return err
+				}
+				shellIn, shellReader = in, bufio.NewReader(out)
+				return nil
+			}
+			Expect(startShell()).To(Succeed())
+			DeferCleanup(func() {
+				shellIn.Close()
+				syscall.Kill(-shell.Process.Pid, syscall.SIGKILL)
+				shell.Wait()
+			})
+			runInShell := func(command string, env []string, timeout time.Duration) ([]byte, int, error) {
+				marker := fmt.Sprintf("__docsyncer_%d__", time.Now().UnixNano())
+				var script strings.Builder
+				for _, kv := range env {
+					name, val, _ := strings.Cut(kv, "=")
+					fmt.Fprintf(&script, "export %s='%s'\n", name, strings.ReplaceAll(val, "'", "'\\''"))
+				}
+				fmt.Fprintf(&script, "{\n%s\n} </dev/null; printf '\\n%s %%d\\n' $?\n", command, marker)
+				if _, err := shellIn.Write([]byte(script.String())); err != nil {
+					return nil, -1, fmt.Errorf("shell session ended: %w", err)
+				}
+
+				var out []byte
+				code := -1
+				var readErr error
+				done := make(chan struct{})
+				reader := shellReader
+				go func() {
+					defer close(done)
+					for {
+						line, err := reader.ReadBytes('\n')
+						if strings.HasPrefix(string(line), marker+" ") {
+							fmt.Sscanf(string(line[len(marker)+1:]), "%d", &code)
+							out = out[:len(out)-1]
+							return
+						}
+						out = append(out, line...)
+						if err != nil {
+							readErr = fmt.Errorf("shell session ended: %w", err)
+							return
+						}
+					}
+				}()
+
+				var expired <-chan time.Time
+				if timeout > 0 {
+					expired = time.After(timeout)
+				}
+				select {
+				case <-done:
+					return out, code, readErr
+				case <-expired:
+					syscall.Kill(-shell.Process.Pid, syscall.SIGKILL)
+					shell.Wait()
+					if err := startShell(); err != nil {
+						return nil, -1, fmt.Errorf("step timed out after %s, and restarting the shell session failed: %w", timeout, err)
+					}
+					return nil, -1, fmt.Errorf("step timed out after %s; the shell session was restarted without its working directory and exported variables", timeout)
+				case <-ctx.Done():
+					syscall.Kill(-shell.Process.Pid, syscall.SIGKILL)
+					return nil, -1, ctx.Err()
+				}
+			}`
+
+// generateSessionStep generates the code running a step through runInShell.
+// The timeout applies to each attempt, and an attempt that times out is retried
+// in the restarted shell; captured variables are exported first.
+func generateSessionStep(step domain.TestStep, command string, cmdCfg *config.CommandConfig) string {
+	run := fmt.Sprintf("runInShell(%q, %s, %s)", command, sessionEnv(step.UsesVars), sessionTimeout(step.Timeout))
+
+	if isPolled(step) {
+		goCode := fmt.Sprintf(`output, exitCode, err := %s
+			Expect(err).ToNot(HaveOccurred(), string(output))
+			Expect(exitCode).To(Equal(%d), string(output))`, run, step.ExpectedExit)
+		if assertion := outputAssertion(step, "output", cmdCfg); assertion != "" {
+			goCode += "\n\t\t\t" + assertion
+		}
+		return wrapWithPolling(goCode, step)
+	}
+
+	if step.RetryCount == 0 {
+		goCode := fmt.Sprintf(`output, exitCode, err := %s
+			Expect(err).ToNot(HaveOccurred(), string(output))
+			Expect(exitCode).To(Equal(%d), string(output))`, run, step.ExpectedExit)
+		if after := afterRun(step, "output", cmdCfg); after != "" {
+			goCode += "\n\t\t\t" + after
+		}
+		return goCode
+	}
+
+	return fmt.Sprintf(`{
+			var lastOutput []byte
+			var lastErr error
+			lastCode := -1
+			for attempt := 1; attempt <= %d; attempt++ {
+				lastOutput, lastCode, lastErr = %s
+				if lastErr == nil && lastCode == %d {
+					break
+				}
+				if attempt <= %d {
+					time.Sleep(%s)
+				}
+			}
+			Expect(lastErr).ToNot(HaveOccurred(), string(lastOutput))
+			Expect(lastCode).To(Equal(%d), string(lastOutput))%s
+		}`, step.RetryCount+1, run, step.ExpectedExit, step.RetryCount, formatDuration(step.RetryInterval),
+		step.ExpectedExit, afterLoop(afterRun(step, "lastOutput", cmdCfg)))
+}
+
+// sessionEnv generates the env argument of runInShell for captured variables.
+func sessionEnv(vars []string) string {
+	if len(vars) == 0 {
+		return "nil"
+	}
+	return fmt.Sprintf("[]string{%s}", strings.Join(varEnvEntries(vars), ", "))
+}
+
+// sessionTimeout generates the timeout argument of runInShell; 0 means none.
+func sessionTimeout(timeout string) string {
+	if timeout == "" || timeout == "0" || timeout == "0s" {
+		return "0"
+	}
+	return formatDuration(timeout)
+}
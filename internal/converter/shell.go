@@ -0,0 +1,207 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// shellCommand is a block's command as understood by the shell parser.
+type shellCommand struct {
+	args   []string // argv of a single simple command run without a shell; nil when the shell is needed
+	script string   // script passed to the shell when args is nil
+}
+
+// shellSyntaxError is a command that the shell parser rejects. Line is relative
+// to the first line of the command until checkShellSyntax makes it a line of
+// the document.
+type shellSyntaxError struct {
+	Line int
+	Msg  string
+}
+
+func (e *shellSyntaxError) Error() string {
+	return fmt.Sprintf("shell syntax error: %s", e.Msg)
+}
+
+// parseShell parses command as a bash script, the most permissive dialect, so
+// documents written for bash or POSIX sh both parse. Comments are dropped.
+func parseShell(command string) (*syntax.File, error) {
+	f, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).
+		Parse(strings.NewReader(command), "")
+	if err != nil {
+		var perr syntax.ParseError
+		if errors.As(err, &perr) {
+			return nil, &shellSyntaxError{Line: int(perr.Pos.Line()), Msg: perr.Text}
+		}
+		return nil, &shellSyntaxError{Line: 1, Msg: err.Error()}
+	}
+	if len(f.Stmts) == 0 {
+		return nil, &shellSyntaxError{Line: 1, Msg: "no command to run"}
+	}
+	return f, nil
+}
+
+// checkShellSyntax reports a *shellSyntaxError, at its line in the document,
+// when command, whose first line is firstLine, cannot be parsed.
+func checkShellSyntax(command string, firstLine int) error {
+	_, err := parseShell(command)
+	var serr *shellSyntaxError
+	if errors.As(err, &serr) {
+		serr.Line += firstLine - 1
+	}
+	return err
+}
+
+// analyzeCommand decides how command runs. A single simple command whose words
+// are all literals runs without a shell. Anything else (pipes, redirects,
+// expansions, globs, compound commands, several statements) runs in the shell.
+// Statements are joined with && so that, as before, the first failing line
+// fails the step; if/for/while blocks, line continuations and heredocs keep
+// their meaning. A command that does not parse is passed to the shell as is.
+func analyzeCommand(command string) shellCommand {
+	command = strings.TrimSpace(command)
+	f, err := parseShell(command)
+	if err != nil {
+		return shellCommand{script: command}
+	}
+
+	if len(f.Stmts) == 1 {
+		if args, ok := literalArgs(f.Stmts[0]); ok {
+			return shellCommand{args: args}
+		}
+		return shellCommand{script: command}
+	}
+	return shellCommand{script: andList(f.Stmts)}
+}
+
+// andList prints stmts as one && list. A background statement is put in a
+// { ...; } group, so it still starts in the background and lets the list go on;
+// so are negated statements and && or || lists, so that a later "|| true"
+// does not hide an earlier failing line.
+func andList(stmts []*syntax.Stmt) string {
+	var list *syntax.Stmt
+	for i := len(stmts) - 1; i >= 0; i-- {
+		s := stmts[i]
+		if s.Background || s.Negated || isAndOrList(s) {
+			s = &syntax.Stmt{Cmd: &syntax.Block{Stmts: []*syntax.Stmt{s}}}
+		}
+		if list == nil {
+			list = s
+			continue
+		}
+		list = &syntax.Stmt{Cmd: &syntax.BinaryCmd{Op: syntax.AndStmt, X: s, Y: list}}
+	}
+
+	var b strings.Builder
+	syntax.NewPrinter().Print(&b, list)
+	return strings.TrimSpace(b.String())
+}
+
+// isAndOrList reports whether s is an && or || list.
+func isAndOrList(s *syntax.Stmt) bool {
+	bin, ok := s.Cmd.(*syntax.BinaryCmd)
+	return ok && (bin.Op == syntax.AndStmt || bin.Op == syntax.OrStmt)
+}
+
+// endsInBackground reports whether the last statement of command is sent to
+// the background with &, and returns the command without that &.
+func endsInBackground(command string) (string, bool) {
+	f, err := parseShell(command)
+	if err != nil {
+		return command, false
+	}
+	trimmed := strings.TrimSpace(command)
+	if !f.Stmts[len(f.Stmts)-1].Background || !strings.HasSuffix(trimmed, "&") {
+		return command, false
+	}
+	return strings.TrimSpace(strings.TrimSuffix(trimmed, "&")), true
+}
+
+// literalArgs returns the argv of stmt when it is a plain command whose words
+// need no shell: no redirects, assignments, expansions, globs or tilde.
+func literalArgs(stmt *syntax.Stmt) ([]string, bool) {
+	if stmt.Negated || stmt.Background || stmt.Coprocess || len(stmt.Redirs) > 0 {
+		return nil, false
+	}
+	call, ok := stmt.Cmd.(*syntax.CallExpr)
+	if !ok || len(call.Assigns) > 0 || len(call.Args) == 0 {
+		return nil, false
+	}
+
+	args := make([]string, 0, len(call.Args))
+	for _, word := range call.Args {
+		arg, ok := wordLiteral(word)
+		if !ok || hasGlob(word) {
+			return nil, false
+		}
+		args = append(args, arg)
+	}
+	return args, true
+}
+
+// wordLiteral returns the value of word after quote removal when it holds no
+// parameter, command or arithmetic expansion.
+func wordLiteral(word *syntax.Word) (string, bool) {
+	var b strings.Builder
+	for _, part := range word.Parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			b.WriteString(unescape(p.Value, ""))
+		case *syntax.SglQuoted:
+			if p.Dollar {
+				return "", false
+			}
+			b.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			if p.Dollar {
+				return "", false
+			}
+			for _, qp := range p.Parts {
+				lit, ok := qp.(*syntax.Lit)
+				if !ok {
+					return "", false
+				}
+				b.WriteString(unescape(lit.Value, "$`\"\\\n"))
+			}
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// hasGlob reports whether the unquoted text of word has a glob, a leading
+// tilde or a brace expansion, which the shell expands.
+func hasGlob(word *syntax.Word) bool {
+	for i, part := range word.Parts {
+		lit, ok := part.(*syntax.Lit)
+		if !ok {
+			continue
+		}
+		if strings.ContainsAny(lit.Value, "*?[") || (i == 0 && strings.HasPrefix(lit.Value, "~")) ||
+			(strings.Contains(lit.Value, "{") && (strings.Contains(lit.Value, ",") || strings.Contains(lit.Value, ".."))) {
+			return true
+		}
+	}
+	return false
+}
+
+// unescape removes the backslashes quoting a character in s: any character
+// when escapable is empty (unquoted text), else only those in escapable
+// (double-quoted text). A backslash-newline is a line continuation and vanishes.
+func unescape(s, escapable string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (escapable == "" || strings.IndexByte(escapable, s[i+1]) >= 0) {
+			i++
+			if s[i] == '\n' {
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
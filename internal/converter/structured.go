@@ -0,0 +1,319 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
+)
+
+// Syntaxes for domain.StructuredAssertion.Syntax.
+const (
+	SyntaxJQ       = "jq"       // jq subset, e.g. .status.phase == "Running"
+	SyntaxJSONPath = "jsonpath" // kubectl JSONPath, e.g. {.spec.replicas}=3
+)
+
+// structuredExpr is a parsed structured output assertion: a path into the
+// decoded document, an optional comparison operator and the value to compare with.
+type structuredExpr struct {
+	path  []interface{} // object keys (string) and array indexes (int)
+	op    string        // "", "==", "!=", ">", ">=", "<", "<="
+	value interface{}   // string, float64, bool or nil
+}
+
+// comparisonOps lists the supported operators, two-character ones first.
+var comparisonOps = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+// parseStructuredAssertion parses a jq-subset or JSONPath assertion.
+//
+// jq expressions are a path made of .key, ."key", ["key"] and [N] segments,
+// optionally followed by a comparison with a JSON literal:
+//
+//	.status.phase == "Running"
+//	.items[0].spec.replicas >= 2
+//	.metadata.labels["app.kubernetes.io/name"]
+//
+// JSONPath expressions wrap the path in braces and compare with = (or ==, !=)
+// against an unquoted value, as printed by kubectl -o jsonpath:
+//
+//	{.spec.replicas}=3
+//	{.status.conditions[0].type}=Ready
+//
+// An expression without comparison asserts that the value exists (JSONPath) or
+// is truthy, i.e. neither null nor false (jq).
+func parseStructuredAssertion(a domain.StructuredAssertion) (*structuredExpr, error) {
+	expr := strings.TrimSpace(a.Expr)
+	switch a.Syntax {
+	case SyntaxJQ:
+		return parseJQExpr(expr)
+	case SyntaxJSONPath:
+		return parseJSONPathExpr(expr)
+	}
+	return nil, fmt.Errorf("unknown assertion syntax %q", a.Syntax)
+}
+
+// parseJQExpr parses a jq-subset expression.
+func parseJQExpr(expr string) (*structuredExpr, error) {
+	pathText, op, rhs := splitComparison(expr)
+	path, err := parsePath(strings.TrimSpace(pathText))
+	if err != nil {
+		return nil, fmt.Errorf("invalid jq expression %q: %w", expr, err)
+	}
+	e := &structuredExpr{path: path, op: op}
+	if op == "" {
+		return e, nil
+	}
+
+	if err := json.Unmarshal([]byte(strings.TrimSpace(rhs)), &e.value); err != nil {
+		return nil, fmt.Errorf("invalid jq expression %q: right-hand side %q is not a JSON literal (quote strings)", expr, strings.TrimSpace(rhs))
+	}
+	if err := checkOperand(e); err != nil {
+		return nil, fmt.Errorf("invalid jq expression %q: %w", expr, err)
+	}
+	return e, nil
+}
+
+// parseJSONPathExpr parses a {path}=value JSONPath expression.
+func parseJSONPathExpr(expr string) (*structuredExpr, error) {
+	if !strings.HasPrefix(expr, "{") {
+		return nil, fmt.Errorf("invalid JSONPath expression %q: the path must be wrapped in braces, e.g. {.spec.replicas}=3", expr)
+	}
+	end := strings.Index(expr, "}")
+	if end < 0 {
+		return nil, fmt.Errorf("invalid JSONPath expression %q: missing closing brace", expr)
+	}
+	pathText := strings.TrimPrefix(strings.TrimSpace(expr[1:end]), "$")
+	path, err := parsePath(pathText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSONPath expression %q: %w", expr, err)
+	}
+	e := &structuredExpr{path: path}
+
+	rest := strings.TrimSpace(expr[end+1:])
+	switch {
+	case rest == "":
+		return e, nil
+	case strings.HasPrefix(rest, "=="), strings.HasPrefix(rest, "!="):
+		e.op, rest = rest[:2], rest[2:]
+	case strings.HasPrefix(rest, "="):
+		e.op, rest = "==", rest[1:]
+	default:
+		return nil, fmt.Errorf("invalid JSONPath expression %q: expected =, == or != after the path", expr)
+	}
+
+	// Values are compared as kubectl prints them: JSON literals keep their
+	// type, anything else is a plain string
+	rest = strings.TrimSpace(rest)
+	if err := json.Unmarshal([]byte(rest), &e.value); err != nil {
+		e.value = rest
+	}
+	switch e.value.(type) {
+	case map[string]interface{}, []interface{}:
+		e.value = rest
+	}
+	return e, nil
+}
+
+// splitComparison splits expr at the first comparison operator outside quotes
+// and brackets. It returns expr unchanged with an empty operator when there is none.
+func splitComparison(expr string) (lhs, op, rhs string) {
+	depth := 0
+	inQuote := false
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case inQuote:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inQuote = false
+			}
+		case c == '"':
+			inQuote = true
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case depth == 0:
+			for _, o := range comparisonOps {
+				if strings.HasPrefix(expr[i:], o) {
+					return expr[:i], o, expr[i+len(o):]
+				}
+			}
+		}
+	}
+	return expr, "", ""
+}
+
+// parsePath parses a path such as .items[0].metadata["name"] into segments.
+// "." alone addresses the whole document.
+func parsePath(p string) ([]interface{}, error) {
+	if !strings.HasPrefix(p, ".") && !strings.HasPrefix(p, "[") {
+		return nil, fmt.Errorf("path %q must start with '.'", p)
+	}
+	if p == "." {
+		return nil, nil
+	}
+
+	var path []interface{}
+	for i := 0; i < len(p); {
+		switch p[i] {
+		case '.':
+			i++
+			if i < len(p) && p[i] == '"' {
+				key, n, err := readQuoted(p[i:])
+				if err != nil {
+					return nil, err
+				}
+				path = append(path, key)
+				i += n
+				continue
+			}
+			start := i
+			for i < len(p) && p[i] != '.' && p[i] != '[' {
+				i++
+			}
+			if i == start {
+				if i < len(p) && p[i] == '[' {
+					continue // .[0] / .["key"]
+				}
+				return nil, fmt.Errorf("empty key in path %q", p)
+			}
+			path = append(path, p[start:i])
+		case '[':
+			end := strings.Index(p[i:], "]")
+			if end < 0 {
+				return nil, fmt.Errorf("missing ']' in path %q", p)
+			}
+			inner := strings.TrimSpace(p[i+1 : i+end])
+			if strings.HasPrefix(inner, "\"") || strings.HasPrefix(inner, "'") {
+				key, n, err := readQuoted(inner)
+				if err != nil || n != len(inner) {
+					return nil, fmt.Errorf("invalid key %s in path %q", inner, p)
+				}
+				path = append(path, key)
+			} else {
+				idx, err := strconv.Atoi(inner)
+				if err != nil || idx < 0 {
+					return nil, fmt.Errorf("unsupported index [%s] in path %q — use a non-negative number or a quoted key", inner, p)
+				}
+				path = append(path, idx)
+			}
+			i += end + 1
+		default:
+			return nil, fmt.Errorf("unexpected %q in path %q", p[i], p)
+		}
+	}
+	return path, nil
+}
+
+// readQuoted reads a single- or double-quoted key at the start of s and
+// returns the key and the number of bytes consumed.
+func readQuoted(s string) (string, int, error) {
+	quote := s[0]
+	end := strings.IndexByte(s[1:], quote)
+	if end < 0 {
+		return "", 0, fmt.Errorf("unterminated quoted key %s", s)
+	}
+	return s[1 : end+1], end + 2, nil
+}
+
+// checkOperand rejects object and array operands and ordering comparisons
+// against non-numeric values.
+func checkOperand(e *structuredExpr) error {
+	switch e.value.(type) {
+	case map[string]interface{}, []interface{}:
+		return fmt.Errorf("comparing objects or arrays is not supported — compare a scalar field instead")
+	}
+	switch e.op {
+	case ">", ">=", "<", "<=":
+		if _, ok := e.value.(float64); !ok {
+			return fmt.Errorf("operator %s needs a number, got %v", e.op, e.value)
+		}
+	}
+	return nil
+}
+
+// structuredAssertionCode generates Go code that decodes the []byte variable
+// outputVar as JSON or YAML, walks the path and applies the comparison.
+// The assertion must have been validated with parseStructuredAssertion.
+func structuredAssertionCode(a domain.StructuredAssertion, outputVar string) string {
+	e, err := parseStructuredAssertion(a)
+	if err != nil {
+		return ""
+	}
+
+	expr := strings.TrimSpace(a.Expr)
+	return fmt.Sprintf(`{
+				%s
+				Expect(val).%s, %q)
+			}`, lookupCode(a.Format, e.path, outputVar, expr), structuredMatcher(e, a.Syntax), expr)
+}
+
+// lookupCode generates Go code that decodes the []byte variable outputVar as
+// JSON or YAML and walks path, leaving the value found in a variable named val.
+// desc describes the lookup in failure messages.
+func lookupCode(format string, path []interface{}, outputVar, desc string) string {
+	decode := fmt.Sprintf("json.Unmarshal(%s, &doc)", outputVar)
+	if format == "yaml" {
+		decode = fmt.Sprintf("yaml.Unmarshal(%s, &doc)", outputVar)
+	}
+
+	segs := make([]string, len(path))
+	for i, s := range path {
+		if key, ok := s.(string); ok {
+			segs[i] = fmt.Sprintf("%q", key)
+		} else {
+			segs[i] = fmt.Sprintf("%d", s)
+		}
+	}
+
+	return fmt.Sprintf(`var doc interface{}
+				Expect(%s).To(Succeed(), string(%s))
+				val := doc
+				for _, seg := range []interface{}{%s} {
+					switch s := seg.(type) {
+					case string:
+						obj, ok := val.(map[string]interface{})
+						Expect(ok).To(BeTrue(), "%%s: expected an object at %%q, got %%v", %q, s, val)
+						val = obj[s]
+					case int:
+						arr, ok := val.([]interface{})
+						Expect(ok && s < len(arr)).To(BeTrue(), "%%s: expected an array with index %%d, got %%v", %q, s, val)
+						val = arr[s]
+					}
+				}`, decode, outputVar, strings.Join(segs, ", "), desc, desc)
+}
+
+// structuredMatcher returns the To(...)/ToNot(...) call for a parsed expression,
+// without its closing parenthesis so a description can follow.
+func structuredMatcher(e *structuredExpr, syntax string) string {
+	if e.op == "" {
+		if syntax == SyntaxJSONPath {
+			return "ToNot(BeNil()"
+		}
+		return "ToNot(Or(BeNil(), Equal(false))"
+	}
+
+	var m string
+	switch v := e.value.(type) {
+	case nil:
+		m = "BeNil()"
+	case float64:
+		op := e.op
+		if op == "!=" {
+			op = "=="
+		}
+		m = fmt.Sprintf("BeNumerically(%q, %s)", op, strconv.FormatFloat(v, 'g', -1, 64))
+	case string:
+		m = fmt.Sprintf("Equal(%q)", v)
+	case bool:
+		m = fmt.Sprintf("Equal(%t)", v)
+	}
+	if e.op == "!=" {
+		return "ToNot(" + m
+	}
+	return "To(" + m
+}
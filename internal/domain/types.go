@@ -1,12 +1,14 @@
 package domain
 
+import "time"
+
 // ParsedDocument holds the result of parsing a single document file.
 type ParsedDocument struct {
 	FilePath string
 	FileType string            // "markdown" or "asciidoc"
 	Blocks   []CodeBlock       // All extracted code blocks (tagged ones)
 	Headings []Heading         // Document structure (for context inference)
-	Metadata map[string]string // Any document-level metadata found
+	Metadata map[string]string // Document-level metadata (front matter / header attributes, last test-start)
 }
 
 // CodeBlock represents a single tagged code block extracted from a document.
@@ -16,8 +18,10 @@ type CodeBlock struct {
 	LineNumber int               // 1-based line number in source
 	Attributes map[string]string // Key-value attributes from the fence info
 	Context    string            // Nearest heading / section title
-	TestFile   string            // test-start name — controls output file (empty if ungrouped)
+	TestFile   string            // test-start marker or init attribute name — controls output file (empty if ungrouped)
 	StepGroup  string            // test-step-start name — controls It() block grouping
+	SourceFile string            // File the block was read from when it differs from the document (e.g. AsciiDoc include::)
+	Title      string            // Block title (e.g. AsciiDoc .Title line) — default step name
 }
 
 // Heading represents a document heading for context inference.
@@ -38,17 +42,66 @@ type TestSpec struct {
 	TemplateName  string
 	TestFile      string   // controls output file naming (empty = use SourceFile)
 	Labels        []string // Ginkgo Label() decorators for test filtering
+	Skip          string   // skip reason — non-empty marks the It() block as skipped
+	SessionCode   string   // Go code starting the It() block's persistent shell session (empty = isolated steps)
+	// Steps placed outside the It() blocks, shared by all specs of a Describe:
+	SetupSteps     []TestStep // BeforeEach
+	CleanupSteps   []TestStep // DeferCleanup registered before the setup steps, so it runs even when a step fails
+	BeforeAllSteps []TestStep // BeforeAll (makes the Describe Ordered)
+	AfterAllSteps  []TestStep // DeferCleanup registered in BeforeAll: runs once after all It blocks and their cleanup
 }
 
 // TestStep is a single executable step within a test.
 type TestStep struct {
-	Name          string
-	Command       string
-	GoCode        string // Generated Go code for this step
-	ExpectedExit  int
-	Timeout       string
-	LineNumber    int
-	SkipOnFailure bool
-	RetryCount    int    // Number of retries (0 = no retry)
-	RetryInterval string // Duration between retries (e.g. "2s")
+	Name           string
+	Command        string
+	GoCode         string // Generated Go code for this step
+	ExpectedExit   int
+	Timeout        string
+	LineNumber     int
+	SourceFile     string // File the step's block was read from: the document, or a file it includes (AsciiDoc include::)
+	SkipOnFailure  bool   // A failed step skips the rest of the spec (optional prerequisites)
+	RetryCount     int    // Number of retries (0 = no retry)
+	RetryInterval  string // Duration between retries (e.g. "2s")
+	ExpectedOutput string // Expected output: console session sample output or a companion output block
+	OutputMatch    string // How ExpectedOutput is asserted (exact, contains, regex, lines); empty = not asserted
+	// StructuredAssertions check fields of JSON or YAML output (e.g. kubectl -o json)
+	StructuredAssertions []StructuredAssertion
+	CaptureVar           string          // Variable the trimmed output is stored in for later steps (capture=NAME)
+	CaptureRegex         string          // Optional regex extracting the captured value (first group, else whole match)
+	CaptureJSONPath      string          // Optional JSONPath extracting the captured value from JSON output
+	UsesVars             []string        // Captured variables the command references as ${NAME}
+	InSession            bool            // Runs in the It() block's persistent shell session
+	Env                  []string        // Extra environment entries (KEY=VALUE) on top of the inherited environment
+	Dir                  string          // Working directory of the command (empty = the test's working directory)
+	Stdin                string          // Inline standard input
+	StdinFile            string          // File read as standard input (takes precedence over Stdin)
+	ContinueOnError      bool            // A failed step is logged to GinkgoWriter and the spec goes on
+	Eventually           string          // Poll the step until it passes within this duration (e.g. "2m")
+	Consistently         string          // Poll the step for this duration; every attempt must pass
+	PollInterval         string          // Duration between polling attempts (e.g. "5s")
+	MaxDuration          time.Duration   // Longest the step can run given its timeout, retries and polling (0 = unbounded)
+	Background           bool            // Starts a long-lived process that is killed when the node's cleanup runs
+	ReadyWhen            string          // Readiness check of a background step: port:N, tcp:HOST:PORT or a log regex
+	PolicyFindings       []PolicyFinding // Command policy rules that matched the step's commands (warn and allow)
+}
+
+// PolicyFinding is a command policy rule that matched a command of a step.
+type PolicyFinding struct {
+	Rule    string // Rule name, or allowed_binaries / blocked_patterns
+	Action  string // "deny", "warn" or "allow"
+	Command string // The simple command that matched, words separated by single spaces
+	File    string
+	Line    int
+	Message string
+	// Override is the justification of the block's allow-blocked attribute
+	// when it bypassed this deny rule.
+	Override string
+}
+
+// StructuredAssertion is a field check on JSON or YAML step output.
+type StructuredAssertion struct {
+	Format string // "json" or "yaml" — how the output is decoded
+	Syntax string // "jq" (.status.phase == "Running") or "jsonpath" ({.spec.replicas}=3)
+	Expr   string
 }
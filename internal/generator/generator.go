@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
@@ -49,89 +50,39 @@ func NewGenerator(
 // Generate runs the full pipeline: scan → parse → convert → render → write.
 func (g *DefaultGenerator) Generate(cfg *config.Config) error {
 	// Step 1: Clean output directory if configured
+	manifest := &Manifest{}
 	if cfg.Output.CleanBeforeGenerate && !cfg.DryRun {
 		g.log.Debug("Cleaning output directory", "path", cfg.Output.Directory)
-		if err := cleanOutputDir(cfg.Output.Directory); err != nil {
+		var err error
+		if manifest, err = cleanOutputDir(cfg.Output.Directory, g.log); err != nil {
 			return domain.NewErrorWithSuggestion("write", cfg.Output.Directory, 0,
 				"failed to clean output directory",
-				"check file permissions or set output.clean_before_generate to false in docsyncer.yaml",
+				"check file permissions, fix or delete "+ManifestFile+", or set output.clean_before_generate to false in docsyncer.yaml",
 				err)
 		}
-	}
-
-	// Step 2: Scan for documentation files
-	var allFiles []string
-	for _, dir := range cfg.Input.Directories {
-		g.log.Debug("Scanning directory", "path", dir)
-		files, err := g.scanner.Scan(dir, cfg.Input.Include, cfg.Input.Exclude)
-		if err != nil {
-			g.log.Warn("Failed to scan directory", "path", dir, "error", err)
-			continue
-		}
-		allFiles = append(allFiles, files...)
-	}
-
-	if len(allFiles) == 0 {
-		g.log.Warn("No documentation files found")
-		return nil
-	}
-
-	g.log.Info("Found documentation file(s)", "count", len(allFiles))
-
-	// Step 3: Parse each file and convert to TestSpecs
-	var allSpecs []domain.TestSpec
-	for _, filePath := range allFiles {
-		g.log.Debug("Processing", "path", filePath)
-
-		// Read file content
-		content, err := os.ReadFile(filePath)
-		if err != nil {
-			return domain.NewErrorWithSuggestion("parse", filePath, 0,
-				"failed to read file",
-				"check that the file exists and has read permissions",
+	} else if !cfg.DryRun {
+		var err error
+		if manifest, err = readManifest(cfg.Output.Directory); err != nil {
+			return domain.NewErrorWithSuggestion("write", cfg.Output.Directory, 0,
+				"failed to read the generation manifest",
+				"fix or delete "+ManifestFile+" in the output directory",
 				err)
 		}
-
-		// Select parser based on file extension
-		ext := filepath.Ext(filePath)
-		p, err := g.registry.ParserFor(ext)
-		if err != nil {
-			g.log.Warn("No parser found, skipping", "ext", ext, "path", filePath)
-			continue
-		}
-
-		// Parse document
-		doc, err := p.Parse(filePath, content, cfg.Tags.StepTags)
-		if err != nil {
-			return err
-		}
-
-		if len(doc.Blocks) == 0 {
-			g.log.Debug("No tagged blocks found", "path", filePath)
-			continue
-		}
-
-		g.log.Debug("Found tagged block(s)", "count", len(doc.Blocks), "path", filePath)
-
-		// Convert to TestSpecs
-		specs, err := g.converter.Convert(doc, &cfg.Tags)
-		if err != nil {
-			return err
-		}
-
-		allSpecs = append(allSpecs, specs...)
+		manifest.Files = slices.DeleteFunc(manifest.Files, func(e ManifestEntry) bool {
+			_, err := os.Stat(filepath.Join(cfg.Output.Directory, e.Path))
+			return os.IsNotExist(err)
+		})
 	}
 
+	// Steps 2-3: Scan, parse and convert the documentation
+	allSpecs, err := g.Specs(cfg)
+	if err != nil {
+		return err
+	}
 	if len(allSpecs) == 0 {
-		g.log.Warn("No test specs generated from documentation")
 		return nil
 	}
 
-	// Populate labels on each spec: default labels + DescribeBlock name (deduplicated)
-	for i := range allSpecs {
-		allSpecs[i].Labels = buildLabels(cfg.Output.DefaultLabels, allSpecs[i].DescribeBlock)
-	}
-
 	g.log.Info("Generated test spec(s)", "count", len(allSpecs))
 
 	// Step 4: Group specs by output key.
@@ -161,6 +112,7 @@ func (g *DefaultGenerator) Generate(cfg *config.Config) error {
 	}
 
 	// Step 6: Render and write output, one file per grouping key
+	var keptEdits []string
 	for _, key := range keyOrder {
 		specs := specsByKey[key]
 
@@ -186,6 +138,31 @@ func (g *DefaultGenerator) Generate(cfg *config.Config) error {
 			continue
 		}
 
+		// A file edited by hand keeps its edits; the new content goes beside it
+		newPath := outputPath + ".new"
+		if e := manifest.entry(outputFile); e != nil {
+			if edited, err := handEdited(outputPath, e); err == nil && edited {
+				if !cfg.Force {
+					g.log.Warn("Generated file edited by hand, not overwriting it", "path", outputPath, "new", newPath)
+					if err := os.WriteFile(newPath, []byte(rendered), 0644); err != nil {
+						return domain.NewErrorWithSuggestion("write", newPath, 0,
+							"failed to write output file",
+							"check disk space and write permissions for the output directory",
+							err)
+					}
+					keptEdits = append(keptEdits, outputPath)
+					continue
+				}
+				g.log.Warn("Overwriting generated file edited by hand", "path", outputPath)
+			}
+		}
+		if err := os.Remove(newPath); err != nil && !os.IsNotExist(err) {
+			return domain.NewErrorWithSuggestion("write", newPath, 0,
+				"failed to remove the output of an earlier run",
+				"check write permissions for the output directory",
+				err)
+		}
+
 		g.log.Info("Writing", "path", outputPath)
 		if err := os.WriteFile(outputPath, []byte(rendered), 0644); err != nil {
 			return domain.NewErrorWithSuggestion("write", outputPath, 0,
@@ -193,6 +170,18 @@ func (g *DefaultGenerator) Generate(cfg *config.Config) error {
 				"check disk space and write permissions for the output directory",
 				err)
 		}
+		manifest.put(ManifestEntry{Path: outputFile, Sources: specSources(specs), SHA256: contentHash([]byte(rendered))})
+	}
+
+	// Record the generated files, so that clean-up leaves other files alone
+	if !cfg.DryRun {
+		manifest.GeneratorVersion = Version
+		if err := writeManifest(cfg.Output.Directory, manifest); err != nil {
+			return domain.NewErrorWithSuggestion("write", filepath.Join(cfg.Output.Directory, ManifestFile), 0,
+				"failed to write the generation manifest",
+				"check disk space and write permissions for the output directory",
+				err)
+		}
 	}
 
 	// Step 7: Generate suite_test.go if it doesn't already exist
@@ -200,10 +189,139 @@ func (g *DefaultGenerator) Generate(cfg *config.Config) error {
 		return err
 	}
 
+	// Audit: every command a block's allow-blocked attribute let through
+	var overrides []domain.PolicyFinding
+	for _, f := range PolicyFindings(allSpecs) {
+		if f.Override != "" {
+			overrides = append(overrides, f)
+		}
+	}
+	if len(overrides) > 0 {
+		g.log.Warn("Security policy overrides", "count", len(overrides))
+		for _, f := range overrides {
+			g.log.Warn("Override", "file", f.File, "line", f.Line, "rule", f.Rule, "command", f.Command, "reason", f.Override)
+		}
+	}
+
+	if len(keptEdits) > 0 {
+		return domain.NewErrorWithSuggestion("write", cfg.Output.Directory, 0,
+			fmt.Sprintf("%d generated file(s) edited by hand were not overwritten: %s", len(keptEdits), strings.Join(keptEdits, ", ")),
+			"move the changes into the documentation and delete the files (the new output is in the .new file beside each), or run docsyncer generate --force",
+			nil)
+	}
+
 	g.log.Info("Generation complete")
 	return nil
 }
 
+// specSources returns the source documents of specs, in order of first use.
+func specSources(specs []domain.TestSpec) []string {
+	var sources []string
+	for _, spec := range specs {
+		if !slices.Contains(sources, spec.SourceFile) {
+			sources = append(sources, spec.SourceFile)
+		}
+	}
+	return sources
+}
+
+// PolicyFindings returns the command policy findings of all steps of specs.
+func PolicyFindings(specs []domain.TestSpec) []domain.PolicyFinding {
+	var findings []domain.PolicyFinding
+	for _, spec := range specs {
+		for _, steps := range [][]domain.TestStep{spec.Steps, spec.SetupSteps, spec.CleanupSteps, spec.BeforeAllSteps, spec.AfterAllSteps} {
+			for _, step := range steps {
+				findings = append(findings, step.PolicyFindings...)
+			}
+		}
+	}
+	return findings
+}
+
+// Specs scans, parses and converts the documentation of cfg into test specs,
+// the first half of Generate. Commands that match a policy warn rule are logged.
+func (g *DefaultGenerator) Specs(cfg *config.Config) ([]domain.TestSpec, error) {
+	// Scan for documentation files
+	var allFiles []string
+	for _, dir := range cfg.Input.Directories {
+		g.log.Debug("Scanning directory", "path", dir)
+		files, err := g.scanner.Scan(dir, cfg.Input.Include, cfg.Input.Exclude)
+		if err != nil {
+			g.log.Warn("Failed to scan directory", "path", dir, "error", err)
+			continue
+		}
+		allFiles = append(allFiles, files...)
+	}
+
+	if len(allFiles) == 0 {
+		g.log.Warn("No documentation files found")
+		return nil, nil
+	}
+
+	g.log.Info("Found documentation file(s)", "count", len(allFiles))
+
+	// Parse each file and convert to TestSpecs
+	var allSpecs []domain.TestSpec
+	for _, filePath := range allFiles {
+		g.log.Debug("Processing", "path", filePath)
+
+		// Read file content
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, domain.NewErrorWithSuggestion("parse", filePath, 0,
+				"failed to read file",
+				"check that the file exists and has read permissions",
+				err)
+		}
+
+		// Select parser based on file extension
+		ext := filepath.Ext(filePath)
+		p, err := g.registry.ParserFor(ext)
+		if err != nil {
+			g.log.Warn("No parser found, skipping", "ext", ext, "path", filePath)
+			continue
+		}
+
+		// Parse document
+		doc, err := p.Parse(filePath, content, &cfg.Tags)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(doc.Blocks) == 0 {
+			g.log.Debug("No tagged blocks found", "path", filePath)
+			continue
+		}
+
+		g.log.Debug("Found tagged block(s)", "count", len(doc.Blocks), "path", filePath)
+
+		// Convert to TestSpecs
+		specs, err := g.converter.Convert(doc, &cfg.Tags)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range PolicyFindings(specs) {
+			if f.Action == converter.ActionWarn {
+				g.log.Warn("Command matches a policy warn rule", "file", f.File, "line", f.Line, "rule", f.Rule, "command", f.Command, "message", f.Message)
+			}
+		}
+
+		allSpecs = append(allSpecs, specs...)
+	}
+
+	if len(allSpecs) == 0 {
+		g.log.Warn("No test specs generated from documentation")
+		return nil, nil
+	}
+
+	// Populate labels on each spec: default labels + document labels + DescribeBlock name (deduplicated)
+	for i := range allSpecs {
+		allSpecs[i].Labels = buildLabels(cfg.Output.DefaultLabels, allSpecs[i].Labels, allSpecs[i].DescribeBlock)
+	}
+
+	return allSpecs, nil
+}
+
 // buildOutputFilename constructs the output filename.
 // When isTestFile is true, the key is a TestFile name that gets sanitized
 // (lowercase, spaces→underscores, strip non-alphanum). Otherwise, the key
@@ -316,11 +434,12 @@ func packageNameToTestFunc(pkg string) string {
 	return b.String()
 }
 
-// buildLabels creates a deduplicated label list from default labels plus the test name.
-func buildLabels(defaults []string, testName string) []string {
-	seen := make(map[string]bool, len(defaults)+1)
+// buildLabels creates a deduplicated label list from default labels, the
+// spec's own labels (e.g. from document metadata) and the test name.
+func buildLabels(defaults, specLabels []string, testName string) []string {
+	seen := make(map[string]bool, len(defaults)+len(specLabels)+1)
 	var labels []string
-	for _, l := range defaults {
+	for _, l := range append(append([]string{}, defaults...), specLabels...) {
 		if !seen[l] {
 			seen[l] = true
 			labels = append(labels, l)
@@ -331,33 +450,3 @@ func buildLabels(defaults []string, testName string) []string {
 	}
 	return labels
 }
-
-// cleanOutputDir removes all generated files from the output directory.
-func cleanOutputDir(dir string) error {
-	info, err := os.Stat(dir)
-	if os.IsNotExist(err) {
-		return nil // Nothing to clean
-	}
-	if err != nil {
-		return err
-	}
-	if !info.IsDir() {
-		return fmt.Errorf("%s is not a directory", dir)
-	}
-
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return err
-	}
-
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), "_test.go") && entry.Name() != "suite_test.go" {
-			path := filepath.Join(dir, entry.Name())
-			if err := os.Remove(path); err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
-}
@@ -1,7 +1,8 @@
 package generator_test
 
 import (
-	"io"
+	"bytes"
+	"encoding/json"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -23,10 +24,12 @@ var _ = Describe("Generator", func() {
 		cfg       *config.Config
 		outputDir string
 		log       *slog.Logger
+		logs      *bytes.Buffer
 	)
 
 	BeforeEach(func() {
-		log = slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		logs = &bytes.Buffer{}
+		log = slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
 
 		var err error
 		outputDir, err = os.MkdirTemp("", "docsyncer-test-*")
@@ -44,15 +47,7 @@ var _ = Describe("Generator", func() {
 		cfg.Templates.Directory = filepath.Join("..", "..", "templates")
 		cfg.Templates.Default = "ginkgo_default"
 
-		// Set up components
-		s := scanner.NewScanner(true)
-		registry := parser.NewRegistry()
-		registry.Register(parser.NewMarkdownParser())
-		conv := converter.NewConverter(&cfg.Commands)
-		engine, engineErr := tmpl.NewEngine(cfg.Templates.Directory, cfg.Templates.Default, cfg.Output.BuildTag)
-		Expect(engineErr).ToNot(HaveOccurred())
-
-		gen = generator.NewGenerator(s, registry, conv, engine, log)
+		gen = newGenerator(cfg, parser.NewMarkdownParser(), log)
 	})
 
 	AfterEach(func() {
@@ -166,6 +161,139 @@ var _ = Describe("Generator", func() {
 		Expect(string(content)).To(Equal(customContent))
 	})
 
+	It("should log commands matching a policy warn rule with their file and line", func() {
+		cfg.Commands.Policy.Rules = []config.PolicyRule{{Name: "kubectl-apply", Action: "warn", Command: "kubectl", Args: []string{"apply"}}}
+		gen = newGenerator(cfg, parser.NewMarkdownParser(), log)
+		err := gen.Generate(cfg)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(logs.String()).To(MatchRegexp(`msg="Command matches a policy warn rule" file=\S+simple\.md line=\d+ rule=kubectl-apply`))
+	})
+
+	It("should list the commands let through by allow-blocked in an audit section", func() {
+		docsDir, err := os.MkdirTemp("", "docsyncer-docs-*")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(docsDir)
+		doc := "# Cleanup\n\n```go-e2e-step allow-blocked=\"rm-root: runs in a throwaway container\"\nrm -rf /\n```\n"
+		Expect(os.WriteFile(filepath.Join(docsDir, "cleanup.md"), []byte(doc), 0644)).To(Succeed())
+
+		cfg.Input.Directories = []string{docsDir}
+		Expect(gen.Generate(cfg)).To(Succeed())
+		Expect(logs.String()).To(ContainSubstring(`msg="Security policy overrides" count=1`))
+		Expect(logs.String()).To(MatchRegexp(`msg=Override file=\S+cleanup\.md line=4 rule=rm-root command="rm -rf /" reason="runs in a throwaway container"`))
+	})
+
+	It("should give a retried step a NodeTimeout covering the timeout of every attempt", func() {
+		docsDir, err := os.MkdirTemp("", "docsyncer-docs-*")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(docsDir)
+		doc := "# Wait\n\n```go-e2e-step retry=3 timeout=30s retry-interval=5s\nkubectl wait --for=condition=Ready pod/web\n```\n"
+		Expect(os.WriteFile(filepath.Join(docsDir, "wait.md"), []byte(doc), 0644)).To(Succeed())
+
+		cfg.Input.Directories = []string{docsDir}
+		Expect(gen.Generate(cfg)).To(Succeed())
+		content, err := os.ReadFile(filepath.Join(outputDir, "generated_wait_test.go"))
+		Expect(err).ToNot(HaveOccurred())
+
+		// 4 attempts of 30s, 3 intervals of 5s and one minute of slack
+		Expect(string(content)).To(ContainSubstring("}, NodeTimeout(195*time.Second))"))
+		Expect(string(content)).To(MatchRegexp(`for attempt := 1; attempt <= 4; attempt\+\+ \{\s+func\(\) \{\s+dur, err := time.ParseDuration\("30s"\)`))
+	})
+
+	It("should record the generated files in a manifest", func() {
+		Expect(gen.Generate(cfg)).To(Succeed())
+
+		data, err := os.ReadFile(filepath.Join(outputDir, generator.ManifestFile))
+		Expect(err).ToNot(HaveOccurred())
+		var manifest generator.Manifest
+		Expect(json.Unmarshal(data, &manifest)).To(Succeed())
+		Expect(manifest.GeneratorVersion).To(Equal(generator.Version))
+		Expect(manifest.Files).To(HaveLen(3))
+
+		entry := manifest.Files[0]
+		Expect(entry.Path).To(Equal("generated_application_deployment_test.go"))
+		Expect(entry.Sources).To(ConsistOf(HaveSuffix("multi-step.md")))
+		Expect(entry.SHA256).To(HaveLen(64))
+	})
+
+	It("should keep hand-written test files when cleaning", func() {
+		Expect(os.WriteFile(filepath.Join(outputDir, "helpers_test.go"), []byte("package e2e_test\n"), 0644)).To(Succeed())
+		Expect(gen.Generate(cfg)).To(Succeed())
+		Expect(gen.Generate(cfg)).To(Succeed())
+		Expect(filepath.Join(outputDir, "helpers_test.go")).To(BeAnExistingFile())
+	})
+
+	It("should remove stale generated files, listed or carrying the generated header", func() {
+		Expect(gen.Generate(cfg)).To(Succeed())
+		legacy := filepath.Join(outputDir, "generated_old_test.go")
+		Expect(os.WriteFile(legacy, []byte("package e2e_test\n\n// Auto-generated by docsyncer from: old.md\n"), 0644)).To(Succeed())
+
+		cfg.Input.Directories = []string{filepath.Join("..", "..", "testdata", "asciidoc")}
+		cfg.Input.Include = []string{"*.adoc"}
+		gen = newGenerator(cfg, parser.NewAsciiDocParser(), log)
+		Expect(gen.Generate(cfg)).To(Succeed())
+
+		Expect(legacy).ToNot(BeAnExistingFile())
+		Expect(filepath.Join(outputDir, "generated_simple_deployment_test_test.go")).ToNot(BeAnExistingFile())
+		Expect(filepath.Join(outputDir, "generated_sample_test.go")).To(BeAnExistingFile())
+	})
+
+	It("should keep a stale generated file edited by hand and warn about it", func() {
+		Expect(gen.Generate(cfg)).To(Succeed())
+		edited := filepath.Join(outputDir, "generated_simple_deployment_test_test.go")
+		content, err := os.ReadFile(edited)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.WriteFile(edited, append(content, "// local tweak\n"...), 0644)).To(Succeed())
+
+		cfg.Input.Include = []string{"multi-step.md"}
+		Expect(gen.Generate(cfg)).To(Succeed())
+
+		Expect(edited).To(BeAnExistingFile())
+		Expect(logs.String()).To(ContainSubstring(`msg="Generated file was edited by hand, not removing it"`))
+
+		// The kept file stays in the manifest, so a later clean-up still sees it
+		data, err := os.ReadFile(filepath.Join(outputDir, generator.ManifestFile))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("generated_simple_deployment_test_test.go"))
+	})
+
+	It("should keep a generated file edited by hand and write the new output beside it", func() {
+		Expect(gen.Generate(cfg)).To(Succeed())
+		edited := filepath.Join(outputDir, "generated_simple_deployment_test_test.go")
+		Expect(os.WriteFile(edited, []byte("package e2e_test\n"), 0644)).To(Succeed())
+
+		err := gen.Generate(cfg)
+		Expect(err).To(MatchError(ContainSubstring("1 generated file(s) edited by hand were not overwritten: " + edited)))
+		Expect(logs.String()).To(ContainSubstring(`msg="Generated file edited by hand, not overwriting it"`))
+		content, err := os.ReadFile(edited)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal("package e2e_test\n"))
+		content, err = os.ReadFile(edited + ".new")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring("Describe"))
+
+		// The other files are still written, and the edit is still detected
+		Expect(filepath.Join(outputDir, "generated_application_deployment_test.go")).To(BeAnExistingFile())
+		Expect(gen.Generate(cfg)).To(MatchError(ContainSubstring("edited by hand were not overwritten")))
+		content, err = os.ReadFile(edited)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal("package e2e_test\n"))
+	})
+
+	It("should overwrite a generated file edited by hand when forced", func() {
+		Expect(gen.Generate(cfg)).To(Succeed())
+		edited := filepath.Join(outputDir, "generated_simple_deployment_test_test.go")
+		Expect(os.WriteFile(edited, []byte("package e2e_test\n"), 0644)).To(Succeed())
+		Expect(gen.Generate(cfg)).ToNot(Succeed())
+
+		cfg.Force = true
+		Expect(gen.Generate(cfg)).To(Succeed())
+		Expect(logs.String()).To(ContainSubstring(`msg="Overwriting generated file edited by hand"`))
+		content, err := os.ReadFile(edited)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring("Describe"))
+		Expect(edited + ".new").ToNot(BeAnExistingFile())
+	})
+
 	It("should respect dry-run mode", func() {
 		cfg.DryRun = true
 		err := gen.Generate(cfg)
@@ -187,3 +315,14 @@ var _ = Describe("Generator", func() {
 		Expect(err).ToNot(HaveOccurred())
 	})
 })
+
+// newGenerator wires the components of cfg with the parser p.
+func newGenerator(cfg *config.Config, p parser.Parser, log *slog.Logger) *generator.DefaultGenerator {
+	registry := parser.NewRegistry()
+	registry.Register(p)
+	conv, err := converter.NewConverter(&cfg.Commands)
+	Expect(err).ToNot(HaveOccurred())
+	engine, err := tmpl.NewEngine(cfg.Templates.Directory, cfg.Templates.Default, cfg.Output.BuildTag)
+	Expect(err).ToNot(HaveOccurred())
+	return generator.NewGenerator(scanner.NewScanner(true), registry, conv, engine, log)
+}
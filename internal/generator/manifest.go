@@ -0,0 +1,177 @@
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Version is the docsyncer version recorded in the generation manifest.
+// Release builds set it with -ldflags "-X <module>/internal/generator.Version=...".
+var Version = "dev"
+
+// ManifestFile is the name of the manifest in the output directory.
+const ManifestFile = ".docsyncer-manifest.json"
+
+// generatedHeader marks the files rendered by the default template.
+const generatedHeader = "// Auto-generated by docsyncer"
+
+// Manifest records the files docsyncer wrote to the output directory, so
+// that clean-up removes only those and leaves hand-written files alone.
+type Manifest struct {
+	GeneratorVersion string          `json:"generator_version"`
+	Files            []ManifestEntry `json:"files"`
+}
+
+// ManifestEntry is a generated file of the output directory.
+type ManifestEntry struct {
+	Path    string   `json:"path"` // relative to the output directory
+	Sources []string `json:"sources"`
+	SHA256  string   `json:"sha256"`
+}
+
+// readManifest loads the manifest of dir; a missing manifest is empty.
+func readManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Manifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestFile, err)
+	}
+	return &m, nil
+}
+
+// writeManifest writes m to dir with its files sorted by path.
+func writeManifest(dir string, m *Manifest) error {
+	slices.SortFunc(m.Files, func(a, b ManifestEntry) int { return strings.Compare(a.Path, b.Path) })
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ManifestFile), append(data, '\n'), 0644)
+}
+
+// entry returns the manifest entry of path, or nil.
+func (m *Manifest) entry(path string) *ManifestEntry {
+	for i := range m.Files {
+		if m.Files[i].Path == path {
+			return &m.Files[i]
+		}
+	}
+	return nil
+}
+
+// put adds e to the manifest, replacing the entry of the same path.
+func (m *Manifest) put(e ManifestEntry) {
+	if old := m.entry(e.Path); old != nil {
+		*old = e
+		return
+	}
+	m.Files = append(m.Files, e)
+}
+
+// contentHash returns the hex SHA-256 of content.
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// handEdited reports whether the file at path differs from what docsyncer
+// wrote there according to e.
+func handEdited(path string, e *ManifestEntry) (bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	return contentHash(content) != e.SHA256, nil
+}
+
+// hasGeneratedHeader reports whether the first 4 KiB of the file at path hold
+// the header of a generated file.
+func hasGeneratedHeader(path string) (bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	head := content[:min(len(content), 4096)]
+	return bytes.Contains(head, []byte(generatedHeader)), nil
+}
+
+// cleanOutputDir removes the generated files of the output directory: those
+// listed in its manifest and, for output written before the manifest existed,
+// test files carrying the generated header. Listed files edited by hand are
+// kept with a warning, and so is everything else, such as hand-written
+// helpers and suite_test.go. It returns the manifest of the files left.
+func cleanOutputDir(dir string, log *slog.Logger) (*Manifest, error) {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return &Manifest{}, nil // Nothing to clean
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	kept := &Manifest{GeneratorVersion: manifest.GeneratorVersion}
+	for _, e := range manifest.Files {
+		path := filepath.Join(dir, e.Path)
+		edited, err := handEdited(path, &e)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if edited {
+			log.Warn("Generated file was edited by hand, not removing it", "path", path,
+				"hint", "move the changes into the documentation, or delete the file")
+			kept.put(e)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, "_test.go") || name == "suite_test.go" || manifest.entry(name) != nil {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		generated, err := hasGeneratedHeader(path)
+		if err != nil {
+			return nil, err
+		}
+		if generated {
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return kept, nil
+}
@@ -1,9 +1,11 @@
 package parser
 
 import (
+	"path/filepath"
 	"regexp"
 	"strings"
 
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
 	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
 )
 
@@ -23,110 +25,208 @@ func (p *AsciiDocParser) SupportedExtensions() []string {
 var (
 	// Matches [source,tag,attr1="val1",attr2="val2"]
 	asciidocSourceRe = regexp.MustCompile(`^\[source,([^,\]]+)(?:,(.+))?\]\s*$`)
-	// Matches ---- delimiter
-	asciidocDelimRe = regexp.MustCompile(`^----+\s*$`)
+	// Matches ---- (listing) and .... (literal) delimiters
+	asciidocDelimRe = regexp.MustCompile(`^(?:-{4,}|\.{4,})\s*$`)
+	// Matches the -- open block delimiter
+	asciidocOpenDelimRe = regexp.MustCompile(`^--\s*$`)
+	// Matches a .Block title line (but not ".." or "...." delimiters)
+	asciidocTitleRe = regexp.MustCompile(`^\.([^.\s].*)$`)
+	// Matches trailing callouts such as <1>, <!--2-->, // <3> or # <4> <5>
+	asciidocCalloutRe = regexp.MustCompile(`\s*(?:(?://|#|--|;;)\s*)?(?:(?:<(?:\d+|\.)>|<!--(?:\d+|\.)-->)\s*)+$`)
 	// Matches == Heading, === Subheading, etc.
 	asciidocHeadingRe = regexp.MustCompile(`^(={2,6})\s+(.+)$`)
+	// Matches a document attribute entry such as :namespace: istio-system
+	asciidocAttrEntryRe = regexp.MustCompile(`^:([\w][\w-]*):\s*(.*)$`)
 )
 
 // Parse parses an AsciiDoc document and extracts tagged code blocks and headings.
-func (p *AsciiDocParser) Parse(filePath string, content []byte, tags []string) (*domain.ParsedDocument, error) {
-	lines := strings.Split(string(content), "\n")
-
-	tagSet := make(map[string]bool)
-	for _, t := range tags {
-		tagSet[t] = true
+// include:: directives are expanded relative to filePath, and document attribute
+// references ({name}) are substituted in block content and attributes. Blocks
+// that come from an included file carry that file in CodeBlock.SourceFile.
+func (p *AsciiDocParser) Parse(filePath string, content []byte, tagCfg *config.TagConfig) (*domain.ParsedDocument, error) {
+	root := filePath
+	if abs, err := filepath.Abs(filePath); err == nil {
+		root = abs
+	}
+	lines, err := expandIncludes(splitAdocLines(filePath, content), make(map[string]string), []string{root})
+	if err != nil {
+		return nil, err
 	}
 
+	tags := tagSet(tagCfg)
+
 	parsed := &domain.ParsedDocument{
 		FilePath: filePath,
 		FileType: "asciidoc",
 		Metadata: make(map[string]string),
 	}
 
+	// Document header attributes provide document-level metadata
+	texts := make([]string, len(lines))
+	for i, l := range lines {
+		texts[i] = l.text
+	}
+	for k, v := range parseAsciidocHeader(texts) {
+		parsed.Metadata[k] = v
+	}
+
+	docAttrs := make(map[string]string)
+	var pendingTitle string // .Title line waiting for the block it belongs to
+	var pendingTag string   // step tag from a // annotation line before the block
+	var pendingAttrs map[string]string
 	var currentHeading string
 	var currentTestFile string
 	var currentStepGroup string
 
 	for i := 0; i < len(lines); i++ {
-		line := lines[i]
+		line := lines[i].text
 		trimmed := strings.TrimSpace(line)
 
-		// Check for test-start / test-end comment markers
-		// AsciiDoc single-line comments start with //
-		if strings.HasPrefix(trimmed, "// test-start:") {
-			name := strings.TrimPrefix(trimmed, "// test-start:")
-			name = strings.TrimSpace(name)
-			currentTestFile = name
-			parsed.Metadata["test-start"] = name
+		// Track document attribute entries for {name} substitution
+		if trackAttributeEntry(trimmed, docAttrs) {
 			continue
-		} else if strings.HasPrefix(trimmed, "// test-end") {
-			currentTestFile = ""
-			continue
-		} else if strings.HasPrefix(trimmed, "// test-step-start:") {
-			name := strings.TrimPrefix(trimmed, "// test-step-start:")
-			name = strings.TrimSpace(name)
-			currentStepGroup = name
+		}
+
+		// A .Title line names the next block; anything but block metadata clears it
+		if m := asciidocTitleRe.FindStringSubmatch(trimmed); m != nil {
+			pendingTitle = substituteAttributes(strings.TrimSpace(m[1]), docAttrs)
 			continue
-		} else if strings.HasPrefix(trimmed, "// test-step-end") {
-			currentStepGroup = ""
+		}
+		title := pendingTitle
+		annTag, annAttrs := pendingTag, pendingAttrs
+		if !strings.HasPrefix(trimmed, "[") {
+			pendingTitle = ""
+			pendingTag, pendingAttrs = "", nil
+		}
+
+		// A "// go-e2e-step name=..." annotation line tags the next ordinary block
+		if strings.HasPrefix(trimmed, "//") && !strings.HasPrefix(trimmed, "///") {
+			if tag, attrs, ok := parseAnnotation(strings.TrimPrefix(trimmed, "//"), tags); ok {
+				pendingTitle = title
+				pendingTag, pendingAttrs = tag, attrs
+				continue
+			}
+		}
+
+		// Check for the configured test / step boundary comment markers
+		// (AsciiDoc single-line comments start with //)
+		if kind, name := matchMarker(trimmed, tagCfg); kind != markerNone {
+			name = substituteAttributes(name, docAttrs)
+			switch kind {
+			case markerTestStart:
+				currentTestFile = name
+				parsed.Metadata["test-start"] = name
+			case markerTestEnd:
+				currentTestFile = ""
+			case markerStepStart:
+				currentStepGroup = name
+			case markerStepEnd:
+				currentStepGroup = ""
+			}
 			continue
 		}
 
 		// Check for headings
 		if m := asciidocHeadingRe.FindStringSubmatch(line); m != nil {
 			level := len(m[1]) - 1 // == is level 1, === is level 2
+			text := substituteAttributes(strings.TrimSpace(m[2]), docAttrs)
 			parsed.Headings = append(parsed.Headings, domain.Heading{
 				Level: level,
-				Text:  strings.TrimSpace(m[2]),
-				Line:  i + 1,
+				Text:  text,
+				Line:  lines[i].num,
 			})
-			currentHeading = strings.TrimSpace(m[2])
+			currentHeading = text
 			continue
 		}
 
 		// Check for [source,tag,...] directive
 		if m := asciidocSourceRe.FindStringSubmatch(line); m != nil {
 			tag := strings.TrimSpace(m[1])
-			if !tagSet[tag] {
-				continue
-			}
 
-			// Parse attributes from the directive
+			// Parse attributes from the directive; they override an annotation line
 			attrs := make(map[string]string)
+			for k, v := range annAttrs {
+				attrs[k] = v
+			}
 			if m[2] != "" {
-				attrs = parseAsciidocAttrs(m[2])
+				for k, v := range parseAsciidocAttrs(m[2]) {
+					attrs[k] = v
+				}
+			}
+			for k, v := range attrs {
+				attrs[k] = substituteAttributes(v, docAttrs)
 			}
 
-			directiveLine := i + 1
+			// An ordinary block is tagged by an annotation line or a role=<tag> attribute
+			if !tags[tag] {
+				if roleTag := roleStepTag(attrs["role"], tags); roleTag != "" {
+					tag = roleTag
+				} else if annTag != "" {
+					tag = annTag
+				} else {
+					continue
+				}
+			}
 
-			// Expect ---- delimiter on next line
+			directive := lines[i]
+			pendingTitle = ""
+			pendingTag, pendingAttrs = "", nil
+
+			// The block title may also follow the attribute line
+			if i+1 < len(lines) {
+				if tm := asciidocTitleRe.FindStringSubmatch(strings.TrimSpace(lines[i+1].text)); tm != nil {
+					title = substituteAttributes(strings.TrimSpace(tm[1]), docAttrs)
+					i++
+				}
+			}
+
+			// Expect a ----, .... or -- delimiter on next line
 			i++
 			if i >= len(lines) {
 				break
 			}
-			if !asciidocDelimRe.MatchString(lines[i]) {
+			delim := strings.TrimSpace(lines[i].text)
+			if !asciidocDelimRe.MatchString(delim) && !asciidocOpenDelimRe.MatchString(delim) {
 				continue
 			}
 
-			// Read content until closing ----
+			// Read content until the matching closing delimiter, stripping callouts
 			i++
 			var contentLines []string
-			contentStartLine := i + 1
-			for i < len(lines) && !asciidocDelimRe.MatchString(lines[i]) {
-				contentLines = append(contentLines, lines[i])
+			var start adocLine
+			if i < len(lines) {
+				start = lines[i]
+			}
+			for i < len(lines) && strings.TrimSpace(lines[i].text) != delim {
+				text := asciidocCalloutRe.ReplaceAllString(lines[i].text, "")
+				contentLines = append(contentLines, substituteAttributes(text, docAttrs))
 				i++
 			}
 
-			_ = directiveLine // used for error reporting if needed
+			// Block attributes may open or close a test file
+			testFile, next, errMsg := applyTestAttributes(attrs, currentTestFile, tagCfg)
+			if errMsg != "" {
+				return nil, domain.NewErrorWithSuggestion("parse", directive.file, directive.num, errMsg,
+					"add a matching test-start marker or init attribute before this block, or remove the end attribute",
+					nil)
+			}
+			if testFile != currentTestFile {
+				parsed.Metadata["test-start"] = testFile
+			}
+			currentTestFile = next
+
 			block := domain.CodeBlock{
 				Tag:        tag,
 				Content:    strings.Join(contentLines, "\n"),
-				LineNumber: contentStartLine,
+				LineNumber: start.num,
 				Attributes: attrs,
 				Context:    currentHeading,
-				TestFile:   currentTestFile,
+				TestFile:   testFile,
 				StepGroup:  currentStepGroup,
+				Title:      title,
+			}
+			if start.file != filePath {
+				block.SourceFile = start.file
 			}
 			parsed.Blocks = append(parsed.Blocks, block)
 		}
@@ -135,6 +235,49 @@ func (p *AsciiDocParser) Parse(filePath string, content []byte, tags []string) (
 	return parsed, nil
 }
 
+// roleStepTag returns the first role in a space-separated role attribute
+// (e.g. role="go-e2e-step highlight") that is a configured step tag.
+func roleStepTag(role string, tags map[string]bool) string {
+	for _, r := range strings.Fields(role) {
+		if tags[r] {
+			return r
+		}
+	}
+	return ""
+}
+
+// parseAsciidocHeader collects the attribute entries of the document header:
+// the lines at the top of the document (around the "= Title" line) up to the
+// first blank line that follows the title or an attribute entry.
+func parseAsciidocHeader(lines []string) map[string]string {
+	attrs := make(map[string]string)
+	inHeader := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			if inHeader {
+				return attrs
+			}
+		case strings.HasPrefix(trimmed, "//"):
+			// Comments may appear anywhere in the header
+		case strings.HasPrefix(trimmed, "= "):
+			inHeader = true
+		default:
+			m := asciidocAttrEntryRe.FindStringSubmatch(trimmed)
+			if m == nil {
+				if !inHeader {
+					return attrs
+				}
+				continue // author or revision line
+			}
+			attrs[m[1]] = strings.TrimSpace(m[2])
+			inHeader = true
+		}
+	}
+	return attrs
+}
+
 // parseAsciidocAttrs parses comma-separated key="value" or key=value attributes.
 func parseAsciidocAttrs(s string) map[string]string {
 	attrs := make(map[string]string)
@@ -145,7 +288,7 @@ func parseAsciidocAttrs(s string) map[string]string {
 		if idx := strings.Index(part, "="); idx > 0 {
 			key := strings.TrimSpace(part[:idx])
 			val := strings.TrimSpace(part[idx+1:])
-			val = strings.Trim(val, "\"'")
+			val = unquote(val)
 			attrs[key] = val
 		}
 	}
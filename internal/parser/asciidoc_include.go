@@ -0,0 +1,236 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
+)
+
+// maxIncludeDepth bounds nested include:: directives.
+const maxIncludeDepth = 64
+
+var (
+	// Matches include::target[attrs]
+	asciidocIncludeRe = regexp.MustCompile(`^include::([^\[]+)\[(.*)\]\s*$`)
+	// Matches tag::name[] and end::name[] region markers inside included files
+	asciidocTagMarkerRe = regexp.MustCompile(`\b(tag|end)::([\w-]+)\[\]`)
+	// Matches {name} attribute references, optionally escaped with a backslash
+	asciidocAttrRefRe = regexp.MustCompile(`\\?\{([\w][\w-]*)\}`)
+	// Matches an attribute unset entry such as :namespace!:
+	asciidocAttrUnsetRe = regexp.MustCompile(`^:([\w][\w-]*)!:\s*$`)
+)
+
+// adocLine is a line of an AsciiDoc document after include expansion,
+// remembering the file and 1-based line number it came from.
+type adocLine struct {
+	text string
+	file string
+	num  int
+}
+
+// splitAdocLines splits file content into numbered lines.
+func splitAdocLines(file string, content []byte) []adocLine {
+	texts := strings.Split(string(content), "\n")
+	lines := make([]adocLine, len(texts))
+	for i, text := range texts {
+		lines[i] = adocLine{text: text, file: file, num: i + 1}
+	}
+	return lines
+}
+
+// expandIncludes resolves include:: directives in lines recursively, relative
+// to the including file. Attribute references in include targets are
+// substituted using the attribute entries seen so far. stack holds the
+// absolute paths of the files currently being expanded, for cycle detection.
+func expandIncludes(lines []adocLine, attrs map[string]string, stack []string) ([]adocLine, error) {
+	var out []adocLine
+	inBlock := false
+	for _, l := range lines {
+		trimmed := strings.TrimSpace(l.text)
+		if asciidocDelimRe.MatchString(trimmed) {
+			inBlock = !inBlock
+		}
+		if !inBlock {
+			trackAttributeEntry(trimmed, attrs)
+		}
+
+		m := asciidocIncludeRe.FindStringSubmatch(trimmed)
+		if m == nil {
+			out = append(out, l)
+			continue
+		}
+
+		target := substituteAttributes(m[1], attrs)
+		included, err := readInclude(l.file, l.num, target, stack)
+		if err != nil {
+			return nil, err
+		}
+		selected, err := selectIncludeLines(splitAdocLines(included.path, included.content), parseAsciidocAttrs(m[2]))
+		if err != nil {
+			return nil, domain.NewError("parse", l.file, l.num, fmt.Sprintf("invalid include:: selector for %q", target), err)
+		}
+		nested, err := expandIncludes(selected, attrs, append(stack, included.abs))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, nested...)
+	}
+	return out, nil
+}
+
+// includedFile is the resolved path and content of an include:: target.
+type includedFile struct {
+	path    string
+	abs     string
+	content []byte
+}
+
+// readInclude resolves an include target relative to the including file,
+// rejecting include cycles and excessive nesting.
+func readInclude(file string, line int, target string, stack []string) (*includedFile, error) {
+	path := target
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(file), target)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+
+	for _, seen := range stack {
+		if seen == abs {
+			return nil, domain.NewErrorWithSuggestion("parse", file, line,
+				fmt.Sprintf("include cycle detected: %s includes %s", file, target),
+				"remove the include:: directive that re-includes a file already being included",
+				nil)
+		}
+	}
+	if len(stack) >= maxIncludeDepth {
+		return nil, domain.NewError("parse", file, line,
+			fmt.Sprintf("include:: nesting exceeds %d levels", maxIncludeDepth), nil)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, domain.NewErrorWithSuggestion("parse", file, line,
+			fmt.Sprintf("failed to read included file %q", target),
+			"include:: paths are resolved relative to the including file — check the path and any {attribute} references in it",
+			err)
+	}
+	return &includedFile{path: path, abs: abs, content: content}, nil
+}
+
+// selectIncludeLines applies the tags= / tag= and lines= selectors of an
+// include:: directive. Tag region marker lines are always dropped.
+func selectIncludeLines(lines []adocLine, attrs map[string]string) ([]adocLine, error) {
+	if spec, ok := attrs["lines"]; ok {
+		ranges, err := parseLineRanges(spec)
+		if err != nil {
+			return nil, err
+		}
+		var picked []adocLine
+		for i, l := range lines {
+			if inLineRanges(i+1, ranges) {
+				picked = append(picked, l)
+			}
+		}
+		lines = picked
+	}
+
+	wanted := make(map[string]bool)
+	for _, key := range []string{"tags", "tag"} {
+		for _, t := range strings.FieldsFunc(attrs[key], func(r rune) bool { return r == ';' || r == ',' }) {
+			wanted[strings.TrimSpace(t)] = true
+		}
+	}
+
+	var out []adocLine
+	depth := 0
+	for _, l := range lines {
+		if m := asciidocTagMarkerRe.FindStringSubmatch(l.text); m != nil {
+			if len(wanted) > 0 && (wanted[m[2]] || wanted["*"]) {
+				if m[1] == "tag" {
+					depth++
+				} else if depth > 0 {
+					depth--
+				}
+			}
+			continue
+		}
+		if len(wanted) == 0 || depth > 0 {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+// lineRange is an inclusive 1-based line range; end < 0 means "to the end".
+type lineRange struct{ start, end int }
+
+// parseLineRanges parses a lines= selector such as "1..5;10;12..-1".
+func parseLineRanges(spec string) ([]lineRange, error) {
+	var ranges []lineRange
+	for _, part := range strings.FieldsFunc(spec, func(r rune) bool { return r == ';' || r == ',' }) {
+		part = strings.TrimSpace(part)
+		startStr, endStr, isRange := strings.Cut(part, "..")
+		start, err := strconv.Atoi(startStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lines selector %q", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(endStr); err != nil {
+				return nil, fmt.Errorf("invalid lines selector %q", part)
+			}
+		}
+		ranges = append(ranges, lineRange{start: start, end: end})
+	}
+	return ranges, nil
+}
+
+// inLineRanges reports whether a 1-based line number falls in any range.
+func inLineRanges(n int, ranges []lineRange) bool {
+	for _, r := range ranges {
+		if n >= r.start && (r.end < 0 || n <= r.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// trackAttributeEntry records :name: value entries and removes :name!: entries.
+// It reports whether the line was an attribute entry.
+func trackAttributeEntry(line string, attrs map[string]string) bool {
+	if m := asciidocAttrUnsetRe.FindStringSubmatch(line); m != nil {
+		delete(attrs, m[1])
+		return true
+	}
+	if m := asciidocAttrEntryRe.FindStringSubmatch(line); m != nil {
+		attrs[m[1]] = substituteAttributes(strings.TrimSpace(m[2]), attrs)
+		return true
+	}
+	return false
+}
+
+// substituteAttributes replaces {name} references with document attribute
+// values. Unknown references and backslash-escaped ones (\{name}) are kept
+// literally, minus the escaping backslash.
+func substituteAttributes(s string, attrs map[string]string) string {
+	if !strings.Contains(s, "{") {
+		return s
+	}
+	return asciidocAttrRefRe.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, `\`) {
+			return ref[1:]
+		}
+		if val, ok := attrs[ref[1:len(ref)-1]]; ok {
+			return val
+		}
+		return ref
+	})
+}
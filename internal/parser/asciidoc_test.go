@@ -7,14 +7,19 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
 	"github.com/fjglira/GoE2E-DocSyncer/internal/parser"
 )
 
 var _ = Describe("AsciiDocParser", func() {
-	var p *parser.AsciiDocParser
+	var (
+		p      *parser.AsciiDocParser
+		tagCfg config.TagConfig
+	)
 
 	BeforeEach(func() {
 		p = parser.NewAsciiDocParser()
+		tagCfg = config.DefaultConfig().Tags
 	})
 
 	Describe("SupportedExtensions", func() {
@@ -34,37 +39,37 @@ var _ = Describe("AsciiDocParser", func() {
 		})
 
 		It("should extract 5 code blocks", func() {
-			doc, err := p.Parse("sample.adoc", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("sample.adoc", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Blocks).To(HaveLen(5))
 		})
 
 		It("should set file type to asciidoc", func() {
-			doc, err := p.Parse("sample.adoc", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("sample.adoc", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.FileType).To(Equal("asciidoc"))
 		})
 
 		It("should extract step-name attributes", func() {
-			doc, err := p.Parse("sample.adoc", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("sample.adoc", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Blocks[0].Attributes["step-name"]).To(Equal("Build Docker image"))
 		})
 
 		It("should extract timeout attributes", func() {
-			doc, err := p.Parse("sample.adoc", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("sample.adoc", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Blocks[1].Attributes["timeout"]).To(Equal("5m"))
 		})
 
 		It("should extract headings", func() {
-			doc, err := p.Parse("sample.adoc", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("sample.adoc", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Headings).ToNot(BeEmpty())
 		})
 
 		It("should set context from nearest heading", func() {
-			doc, err := p.Parse("sample.adoc", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("sample.adoc", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Blocks[0].Context).ToNot(BeEmpty())
 		})
@@ -92,7 +97,7 @@ echo step2
 
 // test-end
 `)
-			doc, err := p.Parse("test.adoc", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("test.adoc", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Blocks).To(HaveLen(2))
 			Expect(doc.Blocks[0].TestFile).To(Equal("First Test"))
@@ -116,7 +121,7 @@ echo grouped
 echo ungrouped
 ----
 `)
-			doc, err := p.Parse("test.adoc", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("test.adoc", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Blocks).To(HaveLen(2))
 			Expect(doc.Blocks[0].TestFile).To(Equal("Grouped"))
@@ -150,7 +155,7 @@ echo verify
 
 // test-end
 `)
-			doc, err := p.Parse("test.adoc", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("test.adoc", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Blocks).To(HaveLen(2))
 			Expect(doc.Blocks[0].TestFile).To(Equal("My Test"))
@@ -180,11 +185,301 @@ echo no-group
 
 // test-end
 `)
-			doc, err := p.Parse("test.adoc", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("test.adoc", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Blocks).To(HaveLen(2))
 			Expect(doc.Blocks[0].StepGroup).To(Equal("Setup"))
 			Expect(doc.Blocks[1].StepGroup).To(BeEmpty())
 		})
 	})
+
+	Describe("Parse custom comment markers", func() {
+		It("should use the configured markers for test and step boundaries", func() {
+			tagCfg.TestStart.CommentMarkers = []string{"// e2e:begin"}
+			tagCfg.TestEnd.CommentMarkers = []string{"// e2e:end"}
+			tagCfg.StepStart.CommentMarkers = []string{"// e2e:step"}
+			tagCfg.StepEnd.CommentMarkers = []string{"// e2e:end-step"}
+
+			content := []byte(`= My Guide
+
+// e2e:begin Istio install
+
+// e2e:step Setup
+
+[source,go-e2e-step]
+----
+echo setup
+----
+
+// e2e:end-step
+
+[source,go-e2e-step]
+----
+echo verify
+----
+
+// e2e:end
+
+// test-start: Ignored
+
+[source,go-e2e-step]
+----
+echo ungrouped
+----
+`)
+			doc, err := p.Parse("test.adoc", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(3))
+			Expect(doc.Blocks[0].TestFile).To(Equal("Istio install"))
+			Expect(doc.Blocks[0].StepGroup).To(Equal("Setup"))
+			Expect(doc.Blocks[1].TestFile).To(Equal("Istio install"))
+			Expect(doc.Blocks[1].StepGroup).To(BeEmpty())
+			Expect(doc.Blocks[2].TestFile).To(BeEmpty())
+		})
+	})
+
+	Describe("Parse block attribute boundaries", func() {
+		It("should start and end a test file from block attributes", func() {
+			content := []byte(`= My Guide
+
+[source,go-e2e-step,init="Istio install"]
+----
+echo install
+----
+
+[source,go-e2e-step,end=true]
+----
+echo verify
+----
+
+[source,go-e2e-step]
+----
+echo ungrouped
+----
+`)
+			doc, err := p.Parse("test.adoc", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(3))
+			Expect(doc.Blocks[0].TestFile).To(Equal("Istio install"))
+			Expect(doc.Blocks[1].TestFile).To(Equal("Istio install"))
+			Expect(doc.Blocks[2].TestFile).To(BeEmpty())
+		})
+
+		It("should reject an end attribute when no test is open", func() {
+			content := []byte(`= My Guide
+
+[source,go-e2e-step,end=true]
+----
+echo verify
+----
+`)
+			_, err := p.Parse("test.adoc", content, &tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("test.adoc:3"))
+		})
+	})
+
+	Describe("Parse document header attributes", func() {
+		It("should store header attribute entries in Metadata", func() {
+			content := []byte(`= My Guide
+Jane Doe
+:describe: Istio install
+:labels: istio, smoke
+:skip: true
+
+:not-header: ignored
+
+[source,go-e2e-step]
+----
+echo hi
+----
+`)
+			doc, err := p.Parse("test.adoc", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Metadata).To(HaveKeyWithValue("describe", "Istio install"))
+			Expect(doc.Metadata).To(HaveKeyWithValue("labels", "istio, smoke"))
+			Expect(doc.Metadata).To(HaveKeyWithValue("skip", "true"))
+			Expect(doc.Metadata).ToNot(HaveKey("not-header"))
+		})
+	})
+
+	Describe("Parse include:: directives and attribute substitution", func() {
+		var guide string
+
+		BeforeEach(func() {
+			guide = filepath.Join("..", "..", "testdata", "asciidoc-include", "guide.adoc")
+		})
+
+		It("should resolve includes relative to the file and substitute attributes", func() {
+			content, err := os.ReadFile(guide)
+			Expect(err).ToNot(HaveOccurred())
+
+			doc, err := p.Parse(guide, content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(3))
+			Expect(doc.Blocks[0].Content).To(Equal("kubectl create namespace istio-system"))
+			Expect(doc.Blocks[0].Attributes["step-name"]).To(Equal("Create istio-system"))
+			Expect(doc.Blocks[0].Context).To(Equal("Install"))
+		})
+
+		It("should apply tags= and lines= selectors", func() {
+			content, err := os.ReadFile(guide)
+			Expect(err).ToNot(HaveOccurred())
+
+			doc, err := p.Parse(guide, content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks[1].Attributes["step-name"]).To(Equal("Check pods"))
+			Expect(doc.Blocks[1].Content).To(Equal("kubectl -n istio-system get pods {literal}"))
+			Expect(doc.Blocks[2].Content).To(Equal("kubectl -n istio-system get deploy"))
+		})
+
+		It("should report line numbers in the file that contributed each block", func() {
+			content, err := os.ReadFile(guide)
+			Expect(err).ToNot(HaveOccurred())
+
+			doc, err := p.Parse(guide, content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks[0].SourceFile).To(HaveSuffix(filepath.Join("partials", "install.adoc")))
+			Expect(doc.Blocks[0].LineNumber).To(Equal(3))
+			Expect(doc.Blocks[1].SourceFile).To(HaveSuffix(filepath.Join("partials", "commands.adoc")))
+			Expect(doc.Blocks[1].LineNumber).To(Equal(9))
+		})
+
+		It("should detect include cycles", func() {
+			path := filepath.Join("..", "..", "testdata", "asciidoc-include", "cycle-a.adoc")
+			content, err := os.ReadFile(path)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = p.Parse(path, content, &tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("include cycle"))
+			Expect(err.Error()).To(ContainSubstring("cycle-b.adoc:1"))
+		})
+
+		It("should report missing include files at the include line", func() {
+			content := []byte("= Guide\n\ninclude::missing.adoc[]\n")
+			_, err := p.Parse("test.adoc", content, &tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("test.adoc:3"))
+		})
+
+		It("should substitute attributes defined in the body", func() {
+			content := []byte(`= Guide
+
+:app: bookinfo
+
+[source,go-e2e-step]
+----
+kubectl get deploy {app} -n {undefined}
+----
+`)
+			doc, err := p.Parse("test.adoc", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks[0].Content).To(Equal("kubectl get deploy bookinfo -n {undefined}"))
+		})
+	})
+
+	Describe("Parse callouts, listing variants and block titles", func() {
+		It("should strip callout markers from block content", func() {
+			content := []byte(`= Guide
+
+[source,go-e2e-step]
+----
+kubectl create namespace demo <1>
+kubectl apply -f app.yaml # <2>
+kubectl get pods // <3> <4>
+echo "<1>" done
+----
+`)
+			doc, err := p.Parse("test.adoc", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks[0].Content).To(Equal("kubectl create namespace demo\nkubectl apply -f app.yaml\nkubectl get pods\necho \"<1>\" done"))
+		})
+
+		It("should support literal and open block delimiters", func() {
+			content := []byte(`= Guide
+
+[source,go-e2e-step]
+....
+kubectl get nodes
+----
+....
+
+[source,go-e2e-step]
+--
+kubectl get ns
+--
+`)
+			doc, err := p.Parse("test.adoc", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(2))
+			Expect(doc.Blocks[0].Content).To(Equal("kubectl get nodes\n----"))
+			Expect(doc.Blocks[1].Content).To(Equal("kubectl get ns"))
+		})
+
+		It("should record the .Title line above or below the source attribute", func() {
+			content := []byte(`= Guide
+
+:app: bookinfo
+
+.Deploy {app}
+[source,go-e2e-step]
+----
+kubectl apply -f bookinfo.yaml
+----
+
+[source,go-e2e-step]
+.Verify the pods
+----
+kubectl get pods
+----
+
+.Not a block title
+
+[source,go-e2e-step]
+----
+kubectl get svc
+----
+`)
+			doc, err := p.Parse("test.adoc", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(3))
+			Expect(doc.Blocks[0].Title).To(Equal("Deploy bookinfo"))
+			Expect(doc.Blocks[1].Title).To(Equal("Verify the pods"))
+			Expect(doc.Blocks[2].Title).To(BeEmpty())
+		})
+	})
+
+	Describe("Parse annotated ordinary blocks", func() {
+		It("should tag blocks from a // annotation line or a role attribute", func() {
+			content := []byte(`= Guide
+
+// go-e2e-step name="Deploy" timeout=60s
+.Deploy the app
+[source,bash]
+----
+kubectl apply -f app.yaml
+----
+
+[source,bash,role="go-e2e-step",step-name="Check pods"]
+----
+kubectl get pods
+----
+
+[source,bash]
+----
+echo not a step
+----
+`)
+			doc, err := p.Parse("test.adoc", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(2))
+			Expect(doc.Blocks[0].Tag).To(Equal("go-e2e-step"))
+			Expect(doc.Blocks[0].Attributes).To(HaveKeyWithValue("name", "Deploy"))
+			Expect(doc.Blocks[0].Attributes).To(HaveKeyWithValue("timeout", "60s"))
+			Expect(doc.Blocks[0].Title).To(Equal("Deploy the app"))
+			Expect(doc.Blocks[1].Tag).To(Equal("go-e2e-step"))
+			Expect(doc.Blocks[1].Attributes).To(HaveKeyWithValue("step-name", "Check pods"))
+		})
+	})
 })
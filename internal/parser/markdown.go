@@ -8,6 +8,7 @@ import (
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/text"
 
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
 	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
 )
 
@@ -25,28 +26,35 @@ func (p *MarkdownParser) SupportedExtensions() []string {
 }
 
 // Parse parses a Markdown document and extracts tagged code blocks and headings.
-func (p *MarkdownParser) Parse(filePath string, content []byte, tags []string) (*domain.ParsedDocument, error) {
-	md := goldmark.New()
-	reader := text.NewReader(content)
-	doc := md.Parser().Parse(reader)
-
+func (p *MarkdownParser) Parse(filePath string, content []byte, tagCfg *config.TagConfig) (*domain.ParsedDocument, error) {
 	parsed := &domain.ParsedDocument{
 		FilePath: filePath,
 		FileType: "markdown",
 		Metadata: make(map[string]string),
 	}
 
-	// Build a set for quick tag lookup
-	tagSet := make(map[string]bool)
-	for _, t := range tags {
-		tagSet[t] = true
+	// YAML front matter provides document-level metadata
+	frontMatter, content, err := extractFrontMatter(filePath, content)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range frontMatter {
+		parsed.Metadata[k] = v
 	}
 
+	md := goldmark.New()
+	reader := text.NewReader(content)
+	doc := md.Parser().Parse(reader)
+
+	// Build a set for quick tag lookup
+	tags := tagSet(tagCfg)
+
 	// Walk the AST to extract headings and code blocks
 	var currentHeading string
 	var currentTestFile string
 	var currentStepGroup string
-	err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+	var attrErr error
+	err = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
 		if !entering {
 			return ast.WalkContinue, nil
 		}
@@ -77,10 +85,13 @@ func (p *MarkdownParser) Parse(filePath string, content []byte, tags []string) (
 			if node.Info != nil {
 				info = string(node.Info.Segment.Value(content))
 			}
-			parts := parseInfoString(info)
+			parts := parseFenceInfo(info, tags)
 			tag := parts["_tag"]
 
-			if tagSet[tag] || tagSet[lang] {
+			// An annotation comment right before the fence tags an ordinary block
+			annTag, annAttrs, annotated := fenceAnnotation(node, content, tags)
+
+			if tags[tag] || tags[lang] || annotated {
 				// Extract code content
 				var buf bytes.Buffer
 				lines := node.Lines()
@@ -89,28 +100,49 @@ func (p *MarkdownParser) Parse(filePath string, content []byte, tags []string) (
 					buf.Write(line.Value(content))
 				}
 
-				// Remove _tag from attributes
+				// Remove _tag from attributes; fence attributes override the annotation
 				attrs := make(map[string]string)
+				for k, v := range annAttrs {
+					attrs[k] = v
+				}
 				for k, v := range parts {
 					if k != "_tag" {
 						attrs[k] = v
 					}
 				}
+				if annotated && !tags[tag] {
+					tag = annTag
+				}
+
+				line := fenceLineNumber(node, content)
+
+				// Fence attributes may open or close a test file
+				testFile, next, errMsg := applyTestAttributes(attrs, currentTestFile, tagCfg)
+				if errMsg != "" {
+					attrErr = domain.NewErrorWithSuggestion("parse", filePath, fenceInfoLine(node, content), errMsg,
+						"add a matching test-start marker or init attribute before this block, or remove the end attribute",
+						nil)
+					return ast.WalkStop, nil
+				}
+				if testFile != currentTestFile {
+					parsed.Metadata["test-start"] = testFile
+				}
+				currentTestFile = next
 
 				block := domain.CodeBlock{
 					Tag:        tag,
 					Content:    strings.TrimRight(buf.String(), "\n"),
-					LineNumber: lineNumber(content, node.Lines().At(0).Start),
+					LineNumber: line,
 					Attributes: attrs,
 					Context:    currentHeading,
-					TestFile:   currentTestFile,
-				StepGroup:  currentStepGroup,
+					TestFile:   testFile,
+					StepGroup:  currentStepGroup,
 				}
 				parsed.Blocks = append(parsed.Blocks, block)
 			}
 
 		case *ast.HTMLBlock:
-			// Check for test-start / test-end / test-step-start / test-step-end comments
+			// Check for the configured test / step boundary comment markers
 			var buf bytes.Buffer
 			lines := node.Lines()
 			for i := 0; i < lines.Len(); i++ {
@@ -118,22 +150,16 @@ func (p *MarkdownParser) Parse(filePath string, content []byte, tags []string) (
 				buf.Write(line.Value(content))
 			}
 			htmlText := strings.TrimSpace(buf.String())
-			if strings.HasPrefix(htmlText, "<!-- test-start:") {
-				// Extract test name from comment
-				name := strings.TrimPrefix(htmlText, "<!-- test-start:")
-				name = strings.TrimSuffix(name, "-->")
-				name = strings.TrimSpace(name)
+			switch kind, name := matchMarker(htmlText, tagCfg); kind {
+			case markerTestStart:
 				currentTestFile = name
 				// Keep backward-compatible metadata (stores the last seen test-start)
 				parsed.Metadata["test-start"] = name
-			} else if strings.HasPrefix(htmlText, "<!-- test-end") {
+			case markerTestEnd:
 				currentTestFile = ""
-			} else if strings.HasPrefix(htmlText, "<!-- test-step-start:") {
-				name := strings.TrimPrefix(htmlText, "<!-- test-step-start:")
-				name = strings.TrimSuffix(name, "-->")
-				name = strings.TrimSpace(name)
+			case markerStepStart:
 				currentStepGroup = name
-			} else if strings.HasPrefix(htmlText, "<!-- test-step-end") {
+			case markerStepEnd:
 				currentStepGroup = ""
 			}
 		}
@@ -147,6 +173,9 @@ func (p *MarkdownParser) Parse(filePath string, content []byte, tags []string) (
 			"check the markdown file for syntax issues — ensure fenced code blocks use triple backticks",
 			err)
 	}
+	if attrErr != nil {
+		return nil, attrErr
+	}
 
 	return parsed, nil
 }
@@ -177,7 +206,7 @@ func parseInfoString(info string) map[string]string {
 			key := part[:idx]
 			val := part[idx+1:]
 			// Remove surrounding quotes
-			val = strings.Trim(val, "\"'")
+			val = unquote(val)
 			result[key] = val
 		}
 	}
@@ -185,6 +214,63 @@ func parseInfoString(info string) map[string]string {
 	return result
 }
 
+// parseFenceInfo parses a fence info string, accepting both the plain form
+// handled by parseInfoString and the Pandoc/Quarto brace form:
+//
+//	"{.bash .go-e2e-step name=\"Deploy\" timeout=60s}"
+//	"bash {.go-e2e-step #deploy}"
+//
+// In the brace form each .class (or bare word, as in Quarto's {bash}) is a
+// candidate tag: the first configured step tag wins, else the first class.
+// #id tokens are ignored and key=value pairs become attributes. Braces inside
+// a plain-form value, as in capture-jsonpath={.metadata.name}, are not the
+// brace form: it needs the info string to start with { or the language to be
+// followed by a separate {...} token.
+func parseFenceInfo(info string, tags map[string]bool) map[string]string {
+	info = strings.TrimSpace(info)
+	lang, attrs := "", info
+	if !strings.HasPrefix(info, "{") {
+		sp := strings.IndexAny(info, " \t")
+		if sp < 0 {
+			return parseInfoString(info)
+		}
+		lang, attrs = info[:sp], strings.TrimSpace(info[sp:])
+	}
+	if !strings.HasPrefix(attrs, "{") || !strings.HasSuffix(attrs, "}") {
+		return parseInfoString(info)
+	}
+
+	result := make(map[string]string)
+	var classes []string
+	if lang != "" {
+		classes = append(classes, lang)
+	}
+	for _, part := range splitInfoString(attrs[1 : len(attrs)-1]) {
+		idx := strings.Index(part, "=")
+		switch {
+		case strings.HasPrefix(part, "#"):
+			// Identifiers do not map to any step attribute
+		case strings.HasPrefix(part, "."):
+			classes = append(classes, strings.TrimPrefix(part, "."))
+		case idx > 0:
+			result[part[:idx]] = unquote(part[idx+1:])
+		default:
+			classes = append(classes, part)
+		}
+	}
+
+	for _, c := range classes {
+		if tags[c] {
+			result["_tag"] = c
+			return result
+		}
+	}
+	if len(classes) > 0 {
+		result["_tag"] = classes[0]
+	}
+	return result
+}
+
 // splitInfoString splits the info string respecting quoted values.
 func splitInfoString(s string) []string {
 	var parts []string
@@ -233,6 +319,51 @@ func extractText(n ast.Node, source []byte) string {
 	return buf.String()
 }
 
+// fenceAnnotation looks for a step annotation comment such as
+// <!-- go-e2e-step name="Deploy" --> immediately before a fenced code block.
+func fenceAnnotation(node *ast.FencedCodeBlock, content []byte, tags map[string]bool) (string, map[string]string, bool) {
+	prev, ok := node.PreviousSibling().(*ast.HTMLBlock)
+	if !ok {
+		return "", nil, false
+	}
+	var buf bytes.Buffer
+	lines := prev.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		buf.Write(line.Value(content))
+	}
+	if prev.HasClosure() {
+		buf.Write(prev.ClosureLine.Value(content))
+	}
+	htmlText := strings.TrimSpace(buf.String())
+	if !strings.HasPrefix(htmlText, "<!--") || !strings.HasSuffix(htmlText, "-->") {
+		return "", nil, false
+	}
+	body := strings.TrimSuffix(strings.TrimPrefix(htmlText, "<!--"), "-->")
+	return parseAnnotation(body, tags)
+}
+
+// fenceLineNumber returns the line of the first content line of a fenced code
+// block, or the line of the fence itself when the block is empty.
+func fenceLineNumber(node *ast.FencedCodeBlock, content []byte) int {
+	if node.Lines().Len() > 0 {
+		return lineNumber(content, node.Lines().At(0).Start)
+	}
+	if node.Info != nil {
+		return lineNumber(content, node.Info.Segment.Start)
+	}
+	return 0
+}
+
+// fenceInfoLine returns the line of the opening fence, which holds the
+// block's attributes, as the AsciiDoc and RST parsers report for them.
+func fenceInfoLine(node *ast.FencedCodeBlock, content []byte) int {
+	if node.Info != nil {
+		return lineNumber(content, node.Info.Segment.Start)
+	}
+	return max(fenceLineNumber(node, content)-1, 0)
+}
+
 // lineNumber calculates the 1-based line number for a byte offset.
 func lineNumber(content []byte, offset int) int {
 	return bytes.Count(content[:offset], []byte("\n")) + 1
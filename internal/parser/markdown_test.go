@@ -7,14 +7,19 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
 	"github.com/fjglira/GoE2E-DocSyncer/internal/parser"
 )
 
 var _ = Describe("MarkdownParser", func() {
-	var p *parser.MarkdownParser
+	var (
+		p      *parser.MarkdownParser
+		tagCfg config.TagConfig
+	)
 
 	BeforeEach(func() {
 		p = parser.NewMarkdownParser()
+		tagCfg = config.DefaultConfig().Tags
 	})
 
 	Describe("SupportedExtensions", func() {
@@ -34,44 +39,45 @@ var _ = Describe("MarkdownParser", func() {
 		})
 
 		It("should extract 3 code blocks", func() {
-			doc, err := p.Parse("simple.md", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("simple.md", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Blocks).To(HaveLen(3))
 		})
 
 		It("should set file type to markdown", func() {
-			doc, err := p.Parse("simple.md", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("simple.md", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.FileType).To(Equal("markdown"))
 		})
 
 		It("should extract step name attribute", func() {
-			doc, err := p.Parse("simple.md", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("simple.md", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Blocks[0].Attributes["step-name"]).To(Equal("Apply deployment manifests"))
 		})
 
 		It("should extract timeout attribute", func() {
-			doc, err := p.Parse("simple.md", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("simple.md", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Blocks[1].Attributes["timeout"]).To(Equal("60s"))
 		})
 
 		It("should extract headings", func() {
-			doc, err := p.Parse("simple.md", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("simple.md", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Headings).ToNot(BeEmpty())
 			Expect(doc.Headings[0].Text).To(Equal("Simple Deployment Guide"))
 		})
 
 		It("should extract test-start metadata", func() {
-			doc, err := p.Parse("simple.md", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("simple.md", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Metadata["test-start"]).To(Equal("Simple deployment test"))
 		})
 
 		It("should not extract blocks with non-matching tags", func() {
-			doc, err := p.Parse("simple.md", content, []string{"other-tag"})
+			tagCfg.StepTags = []string{"other-tag"}
+			doc, err := p.Parse("simple.md", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Blocks).To(BeEmpty())
 		})
@@ -87,20 +93,20 @@ var _ = Describe("MarkdownParser", func() {
 		})
 
 		It("should extract 5 code blocks", func() {
-			doc, err := p.Parse("multi-step.md", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("multi-step.md", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(doc.Blocks).To(HaveLen(5))
 		})
 
 		It("should set context from nearest heading", func() {
-			doc, err := p.Parse("multi-step.md", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("multi-step.md", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			// Each block should have context set from the nearest heading
 			Expect(doc.Blocks[0].Context).ToNot(BeEmpty())
 		})
 
 		It("should ignore bash code blocks", func() {
-			doc, err := p.Parse("multi-step.md", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("multi-step.md", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			for _, block := range doc.Blocks {
 				Expect(block.Tag).To(Equal("go-e2e-step"))
@@ -108,7 +114,7 @@ var _ = Describe("MarkdownParser", func() {
 		})
 
 		It("should assign TestFile from test-start markers", func() {
-			doc, err := p.Parse("multi-step.md", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("multi-step.md", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 
 			// First 2 blocks belong to "Infrastructure provisioning"
@@ -122,7 +128,7 @@ var _ = Describe("MarkdownParser", func() {
 		})
 
 		It("should clear TestFile after test-end", func() {
-			doc, err := p.Parse("multi-step.md", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("multi-step.md", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 			// All blocks in multi-step.md are within test-start/test-end pairs,
 			// so none should have an empty TestFile
@@ -132,7 +138,7 @@ var _ = Describe("MarkdownParser", func() {
 		})
 
 		It("should assign StepGroup from test-step-start markers", func() {
-			doc, err := p.Parse("multi-step.md", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("multi-step.md", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 
 			// First block is in "Setup Database" step group
@@ -146,7 +152,7 @@ var _ = Describe("MarkdownParser", func() {
 		})
 
 		It("should clear StepGroup after test-step-end", func() {
-			doc, err := p.Parse("multi-step.md", content, []string{"go-e2e-step"})
+			doc, err := p.Parse("multi-step.md", content, &tagCfg)
 			Expect(err).ToNot(HaveOccurred())
 
 			// The blocks in "Application deployment" are after test-step-end
@@ -154,4 +160,213 @@ var _ = Describe("MarkdownParser", func() {
 			Expect(doc.Blocks[2].StepGroup).To(BeEmpty())
 		})
 	})
+
+	Describe("Parse custom comment markers", func() {
+		BeforeEach(func() {
+			tagCfg.TestStart.CommentMarkers = []string{"<!-- e2e:begin"}
+			tagCfg.TestEnd.CommentMarkers = []string{"<!-- e2e:end"}
+			tagCfg.StepStart.CommentMarkers = []string{"<!-- e2e:step"}
+			tagCfg.StepEnd.CommentMarkers = []string{"<!-- e2e:end-step"}
+		})
+
+		It("should use the configured markers for test and step boundaries", func() {
+			content := []byte("# Guide\n\n" +
+				"<!-- e2e:begin Istio install -->\n\n" +
+				"<!-- e2e:step Setup -->\n\n" +
+				"```go-e2e-step\necho setup\n```\n\n" +
+				"<!-- e2e:end-step -->\n\n" +
+				"```go-e2e-step\necho verify\n```\n\n" +
+				"<!-- e2e:end -->\n\n" +
+				"```go-e2e-step\necho ungrouped\n```\n")
+			doc, err := p.Parse("custom.md", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(3))
+			Expect(doc.Blocks[0].TestFile).To(Equal("Istio install"))
+			Expect(doc.Blocks[0].StepGroup).To(Equal("Setup"))
+			Expect(doc.Blocks[1].TestFile).To(Equal("Istio install"))
+			Expect(doc.Blocks[1].StepGroup).To(BeEmpty())
+			Expect(doc.Blocks[2].TestFile).To(BeEmpty())
+			Expect(doc.Metadata["test-start"]).To(Equal("Istio install"))
+		})
+
+		It("should ignore the default markers when they are not configured", func() {
+			content := []byte("<!-- test-start: Default -->\n\n```go-e2e-step\necho hi\n```\n")
+			doc, err := p.Parse("custom.md", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(1))
+			Expect(doc.Blocks[0].TestFile).To(BeEmpty())
+		})
+	})
+
+	Describe("Parse fence attribute boundaries", func() {
+		It("should start and end a test file from fence attributes", func() {
+			content := []byte("# Guide\n\n" +
+				"```go-e2e-step init=\"Istio install\"\necho install\n```\n\n" +
+				"```go-e2e-step\necho verify\n```\n\n" +
+				"```go-e2e-step end=true\necho cleanup\n```\n\n" +
+				"```go-e2e-step\necho ungrouped\n```\n")
+			doc, err := p.Parse("attrs.md", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(4))
+			Expect(doc.Blocks[0].TestFile).To(Equal("Istio install"))
+			Expect(doc.Blocks[1].TestFile).To(Equal("Istio install"))
+			Expect(doc.Blocks[2].TestFile).To(Equal("Istio install"))
+			Expect(doc.Blocks[3].TestFile).To(BeEmpty())
+			Expect(doc.Metadata["test-start"]).To(Equal("Istio install"))
+		})
+
+		It("should let an init attribute override an open comment marker", func() {
+			content := []byte("<!-- test-start: From comment -->\n\n" +
+				"```go-e2e-step\necho one\n```\n\n" +
+				"```go-e2e-step init=\"From attribute\"\necho two\n```\n\n" +
+				"<!-- test-end -->\n")
+			doc, err := p.Parse("attrs.md", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(2))
+			Expect(doc.Blocks[0].TestFile).To(Equal("From comment"))
+			Expect(doc.Blocks[1].TestFile).To(Equal("From attribute"))
+		})
+
+		It("should close a test opened by a comment marker", func() {
+			content := []byte("<!-- test-start: Mixed -->\n\n" +
+				"```go-e2e-step end=\"Mixed\"\necho one\n```\n\n" +
+				"```go-e2e-step\necho two\n```\n")
+			doc, err := p.Parse("attrs.md", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks[0].TestFile).To(Equal("Mixed"))
+			Expect(doc.Blocks[1].TestFile).To(BeEmpty())
+		})
+
+		It("should reject an end attribute when no test is open", func() {
+			content := []byte("# Guide\n\n```go-e2e-step end=true\necho one\n```\n")
+			_, err := p.Parse("attrs.md", content, &tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("attrs.md:3"))
+			Expect(err.Error()).To(ContainSubstring("no test is open"))
+		})
+
+		It("should reject an end attribute naming a different test", func() {
+			content := []byte("<!-- test-start: First -->\n\n```go-e2e-step end=\"Second\"\necho one\n```\n")
+			_, err := p.Parse("attrs.md", content, &tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("attrs.md:3"))
+			Expect(err.Error()).To(ContainSubstring("does not match"))
+		})
+	})
+
+	Describe("Parse front matter", func() {
+		It("should store YAML front matter in Metadata", func() {
+			content := []byte("---\n" +
+				"describe: Istio install\n" +
+				"labels: [istio, smoke]\n" +
+				"timeout: 2m\n" +
+				"skip: false\n" +
+				"---\n" +
+				"# Guide\n\n" +
+				"```go-e2e-step\necho hi\n```\n")
+			doc, err := p.Parse("front.md", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Metadata).To(HaveKeyWithValue("describe", "Istio install"))
+			Expect(doc.Metadata).To(HaveKeyWithValue("labels", "istio,smoke"))
+			Expect(doc.Metadata).To(HaveKeyWithValue("timeout", "2m"))
+			Expect(doc.Metadata).To(HaveKeyWithValue("skip", "false"))
+			Expect(doc.Headings[0].Text).To(Equal("Guide"))
+			Expect(doc.Blocks).To(HaveLen(1))
+			Expect(doc.Blocks[0].LineNumber).To(Equal(10))
+		})
+
+		It("should report invalid front matter", func() {
+			content := []byte("---\nlabels: [unclosed\n---\n# Guide\n")
+			_, err := p.Parse("front.md", content, &tagCfg)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("front matter"))
+		})
+	})
+
+	Describe("Parse annotation comments", func() {
+		It("should tag an ordinary fence preceded by an annotation comment", func() {
+			content := []byte("# Guide\n\n" +
+				"<!-- go-e2e-step name=\"Deploy\" timeout=60s -->\n" +
+				"```bash\nkubectl apply -f app.yaml\n```\n\n" +
+				"<!-- go-e2e-step\n     name=\"Wait\" -->\n\n" +
+				"```bash timeout=2m\nkubectl wait --for=condition=Ready pod -l app=demo\n```\n\n" +
+				"```bash\necho not a step\n```\n")
+			doc, err := p.Parse("annotated.md", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(2))
+			Expect(doc.Blocks[0].Tag).To(Equal("go-e2e-step"))
+			Expect(doc.Blocks[0].Content).To(Equal("kubectl apply -f app.yaml"))
+			Expect(doc.Blocks[0].Attributes).To(HaveKeyWithValue("name", "Deploy"))
+			Expect(doc.Blocks[0].Attributes).To(HaveKeyWithValue("timeout", "60s"))
+			Expect(doc.Blocks[0].LineNumber).To(Equal(5))
+			Expect(doc.Blocks[1].Attributes).To(HaveKeyWithValue("name", "Wait"))
+			Expect(doc.Blocks[1].Attributes).To(HaveKeyWithValue("timeout", "2m"))
+		})
+
+		It("should ignore comments that do not start with a step tag", func() {
+			content := []byte("<!-- just a note -->\n```bash\necho hi\n```\n")
+			doc, err := p.Parse("annotated.md", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(BeEmpty())
+		})
+	})
+
+	Describe("Parse Pandoc-style attribute fences", func() {
+		It("should take the tag from a class and attributes from key=value pairs", func() {
+			content := []byte("# Guide\n\n" +
+				"```{.bash .go-e2e-step #deploy name=\"Deploy app\" timeout=60s}\nkubectl apply -f app.yaml\n```\n\n" +
+				"```bash {.go-e2e-step step-name='Check'}\nkubectl get pods\n```\n\n" +
+				"```{.bash .numberLines}\necho not a step\n```\n")
+			doc, err := p.Parse("pandoc.md", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(2))
+			Expect(doc.Blocks[0].Tag).To(Equal("go-e2e-step"))
+			Expect(doc.Blocks[0].Content).To(Equal("kubectl apply -f app.yaml"))
+			Expect(doc.Blocks[0].Attributes).To(Equal(map[string]string{"name": "Deploy app", "timeout": "60s"}))
+			Expect(doc.Blocks[1].Tag).To(Equal("go-e2e-step"))
+			Expect(doc.Blocks[1].Attributes).To(HaveKeyWithValue("step-name", "Check"))
+		})
+
+		It("should accept Quarto bare-word classes", func() {
+			content := []byte("```{go-e2e-step}\necho hi\n```\n")
+			doc, err := p.Parse("quarto.qmd", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(1))
+			Expect(doc.Blocks[0].Tag).To(Equal("go-e2e-step"))
+		})
+
+		It("should keep the plain form when an attribute value contains braces", func() {
+			content := []byte("```go-e2e-step name=X capture=N capture-jsonpath={.metadata.name}\nkubectl get pod web -o json\n```\n")
+			doc, err := p.Parse("braces.md", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(1))
+			Expect(doc.Blocks[0].Tag).To(Equal("go-e2e-step"))
+			Expect(doc.Blocks[0].Attributes).To(Equal(map[string]string{
+				"name": "X", "capture": "N", "capture-jsonpath": "{.metadata.name}",
+			}))
+		})
+	})
+
+	Describe("Parse output blocks", func() {
+		It("should extract blocks tagged with a configured output tag", func() {
+			content := []byte("```go-e2e-step\nkubectl get ns demo\n```\n\n" +
+				"```go-e2e-output match=lines\ndemo   Active\n```\n")
+			doc, err := p.Parse("output.md", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(2))
+			Expect(doc.Blocks[1].Tag).To(Equal("go-e2e-output"))
+			Expect(doc.Blocks[1].Content).To(Equal("demo   Active"))
+			Expect(doc.Blocks[1].Attributes).To(HaveKeyWithValue("match", "lines"))
+		})
+	})
+
+	Describe("Parse quoted attribute values", func() {
+		It("should keep quotes inside a quoted value", func() {
+			content := []byte("```go-e2e-step expect-json='.status.phase == \"Running\"' name=\"it's\"\nkubectl get pod web -o json\n```\n")
+			doc, err := p.Parse("quoted.md", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks[0].Attributes).To(HaveKeyWithValue("expect-json", `.status.phase == "Running"`))
+			Expect(doc.Blocks[0].Attributes).To(HaveKeyWithValue("name", "it's"))
+		})
+	})
 })
@@ -0,0 +1,222 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
+)
+
+// MDXParser parses MDX (Docusaurus) documents. It rewrites the JSX parts of
+// the document into plain Markdown and delegates to MarkdownParser:
+//   - lines holding only JSX/HTML tags (<Tabs>, <TabItem>, ...) are blanked;
+//   - JSX comments {/* ... */} become HTML comments so the configured
+//     comment markers apply unchanged;
+//   - code fences indented inside JSX wrappers are dedented;
+//   - only one <TabItem> per <Tabs> group is kept (see TagConfig.TabValues).
+//
+// Line numbers are preserved because lines are only blanked or rewritten in place.
+type MDXParser struct {
+	markdown *MarkdownParser
+}
+
+// NewMDXParser creates a new MDXParser.
+func NewMDXParser() *MDXParser {
+	return &MDXParser{markdown: NewMarkdownParser()}
+}
+
+// SupportedExtensions returns the file extensions this parser handles.
+func (p *MDXParser) SupportedExtensions() []string {
+	return []string{".mdx"}
+}
+
+var (
+	// Matches a line consisting of a single opening, closing or self-closing tag
+	mdxTagLineRe = regexp.MustCompile(`^<(/?)([A-Za-z][\w.]*)(?:\s[^<>]*?)?(/?)>$`)
+	// Matches the start of a tag whose attributes continue on following lines
+	mdxTagStartRe = regexp.MustCompile(`^<([A-Za-z][\w.]*)(?:\s[^<>]*)?$`)
+	// Matches value="..." on a <TabItem> tag
+	mdxTabValueRe = regexp.MustCompile(`\bvalue=["']([^"']*)["']`)
+	// Matches a bare default attribute on a <TabItem> tag
+	mdxTabDefaultRe = regexp.MustCompile(`\sdefault(\s|/|>|$)`)
+	// Matches an opening or closing code fence
+	mdxFenceRe = regexp.MustCompile("^(`{3,}|~{3,})")
+)
+
+// Parse parses an MDX document and extracts tagged code blocks and headings.
+func (p *MDXParser) Parse(filePath string, content []byte, tagCfg *config.TagConfig) (*domain.ParsedDocument, error) {
+	lines := strings.Split(string(content), "\n")
+	blankUnselectedTabs(lines, tagCfg.TabValues)
+	rewriteMDXLines(lines)
+
+	doc, err := p.markdown.Parse(filePath, []byte(strings.Join(lines, "\n")), tagCfg)
+	if err != nil {
+		return nil, err
+	}
+	doc.FileType = "mdx"
+	return doc, nil
+}
+
+// mdxTabItem is a <TabItem> element and the line range it spans.
+type mdxTabItem struct {
+	value      string
+	isDefault  bool
+	start, end int
+}
+
+// blankUnselectedTabs keeps a single <TabItem> per <Tabs> group and blanks the
+// lines of all others, so alternative variants of the same step (e.g. Helm vs
+// istioctl) do not all become test steps. The kept item is the first whose
+// value appears in preferred (in preference order), else the item marked
+// default, else the first item.
+func blankUnselectedTabs(lines []string, preferred []string) {
+	type tabsGroup struct {
+		items []mdxTabItem
+	}
+	var stack []*tabsGroup
+
+	forEachTagLine(lines, func(start, end int, closing bool, name, tag string) {
+		switch name {
+		case "Tabs":
+			if !closing {
+				stack = append(stack, &tabsGroup{})
+				return
+			}
+			if len(stack) == 0 {
+				return
+			}
+			group := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			keep := selectTabItem(group.items, preferred)
+			for i, item := range group.items {
+				if i == keep || item.end < item.start {
+					continue
+				}
+				for l := item.start; l <= item.end; l++ {
+					lines[l] = ""
+				}
+			}
+		case "TabItem":
+			if len(stack) == 0 {
+				return
+			}
+			group := stack[len(stack)-1]
+			if !closing {
+				item := mdxTabItem{start: start, end: -1, isDefault: mdxTabDefaultRe.MatchString(tag)}
+				if m := mdxTabValueRe.FindStringSubmatch(tag); m != nil {
+					item.value = m[1]
+				}
+				group.items = append(group.items, item)
+				return
+			}
+			if n := len(group.items); n > 0 {
+				group.items[n-1].end = end
+			}
+		}
+	})
+}
+
+// selectTabItem returns the index of the tab item to keep.
+func selectTabItem(items []mdxTabItem, preferred []string) int {
+	for _, want := range preferred {
+		for i, item := range items {
+			if item.value == want {
+				return i
+			}
+		}
+	}
+	for i, item := range items {
+		if item.isDefault {
+			return i
+		}
+	}
+	return 0
+}
+
+// forEachTagLine calls fn for every line (or run of lines, for tags whose
+// attributes span several lines) that holds a single JSX/HTML tag outside
+// code fences. start and end are the first and last line indexes of the tag.
+func forEachTagLine(lines []string, fn func(start, end int, closing bool, name, tag string)) {
+	var fence string
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if m := mdxFenceRe.FindStringSubmatch(trimmed); m != nil {
+			fence = m[1]
+			continue
+		}
+
+		if m := mdxTagLineRe.FindStringSubmatch(trimmed); m != nil {
+			fn(i, i, m[1] == "/", m[2], trimmed)
+			continue
+		}
+		if m := mdxTagStartRe.FindStringSubmatch(trimmed); m != nil {
+			// Attributes continue until a line ending the tag
+			tag := trimmed
+			j := i + 1
+			for ; j < len(lines); j++ {
+				part := strings.TrimSpace(lines[j])
+				tag += " " + part
+				if strings.HasSuffix(part, ">") {
+					break
+				}
+			}
+			if j >= len(lines) {
+				continue
+			}
+			fn(i, j, false, m[1], tag)
+			i = j
+		}
+	}
+}
+
+// rewriteMDXLines blanks JSX tag lines, converts JSX comments to HTML comments
+// and dedents code fences nested in JSX wrappers, in place.
+func rewriteMDXLines(lines []string) {
+	forEachTagLine(lines, func(start, end int, _ bool, _ string, _ string) {
+		for l := start; l <= end; l++ {
+			lines[l] = ""
+		}
+	})
+
+	var fence string
+	fenceIndent := 0
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			lines[i] = trimIndent(line, fenceIndent)
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if m := mdxFenceRe.FindStringSubmatch(trimmed); m != nil {
+			fence = m[1]
+			fenceIndent = indentOf(line)
+			lines[i] = trimmed
+			continue
+		}
+		if strings.HasPrefix(trimmed, "{/*") || strings.HasSuffix(trimmed, "*/}") {
+			trimmed = strings.Replace(trimmed, "{/*", "<!--", 1)
+			if strings.HasSuffix(trimmed, "*/}") {
+				trimmed = strings.TrimSuffix(trimmed, "*/}") + "-->"
+			}
+			lines[i] = trimmed
+		}
+	}
+}
+
+// trimIndent removes up to n leading spaces or tabs from a line.
+func trimIndent(line string, n int) string {
+	i := 0
+	for i < n && i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+	return line[i:]
+}
@@ -0,0 +1,74 @@
+package parser_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/parser"
+)
+
+var _ = Describe("MDXParser", func() {
+	var (
+		p       *parser.MDXParser
+		tagCfg  config.TagConfig
+		content []byte
+	)
+
+	BeforeEach(func() {
+		p = parser.NewMDXParser()
+		tagCfg = config.DefaultConfig().Tags
+
+		var err error
+		content, err = os.ReadFile(filepath.Join("..", "..", "testdata", "mdx", "install.mdx"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Describe("SupportedExtensions", func() {
+		It("should support .mdx", func() {
+			Expect(p.SupportedExtensions()).To(ContainElement(".mdx"))
+		})
+	})
+
+	Describe("Parse install.mdx", func() {
+		It("should see through JSX wrappers and keep the default tab", func() {
+			doc, err := p.Parse("install.mdx", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.FileType).To(Equal("mdx"))
+			Expect(doc.Blocks).To(HaveLen(2))
+			Expect(doc.Blocks[0].Content).To(Equal("istioctl install -y"))
+			Expect(doc.Blocks[0].Attributes["name"]).To(Equal("Install with istioctl"))
+			Expect(doc.Blocks[0].Attributes["title"]).To(Equal("install.sh"))
+			Expect(doc.Blocks[0].LineNumber).To(Equal(17))
+			Expect(doc.Blocks[1].Content).To(Equal("kubectl -n istio-system get pods"))
+		})
+
+		It("should select the configured tab value", func() {
+			tagCfg.TabValues = []string{"helm"}
+			doc, err := p.Parse("install.mdx", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(2))
+			Expect(doc.Blocks[0].Content).To(Equal("helm install istiod istio/istiod -n istio-system"))
+			Expect(doc.Blocks[0].LineNumber).To(Equal(24))
+		})
+
+		It("should treat JSX comments as test markers", func() {
+			doc, err := p.Parse("install.mdx", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks[0].TestFile).To(Equal("Istio install"))
+			Expect(doc.Blocks[1].TestFile).To(Equal("Istio install"))
+			Expect(doc.Metadata["test-start"]).To(Equal("Istio install"))
+		})
+
+		It("should extract headings and context", func() {
+			doc, err := p.Parse("install.mdx", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Headings[0].Text).To(Equal("Install Istio"))
+			Expect(doc.Blocks[0].Context).To(Equal("Install the control plane"))
+			Expect(doc.Blocks[1].Context).To(Equal("Verify"))
+		})
+	})
+})
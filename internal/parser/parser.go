@@ -1,16 +1,22 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
 	"strings"
 	"sync"
 
+	"gopkg.in/yaml.v3"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
 	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
 )
 
 // Parser extracts code blocks from a document.
+// The tag configuration supplies the step tags and the comment markers
+// that delimit test files and step groups.
 type Parser interface {
-	Parse(filePath string, content []byte, tags []string) (*domain.ParsedDocument, error)
+	Parse(filePath string, content []byte, tagCfg *config.TagConfig) (*domain.ParsedDocument, error)
 	SupportedExtensions() []string
 }
 
@@ -66,3 +72,179 @@ func (r *DefaultRegistry) ParserFor(extension string) (Parser, error) {
 	}
 	return nil, fmt.Errorf("no parser registered for extension %q", extension)
 }
+
+// markerKind identifies which boundary a comment marker represents.
+type markerKind int
+
+const (
+	markerNone markerKind = iota
+	markerTestStart
+	markerTestEnd
+	markerStepStart
+	markerStepEnd
+)
+
+// commentClosers are trailing comment terminators stripped from marker names.
+var commentClosers = []string{"-->", "*/"}
+
+// matchMarker checks a trimmed comment line against the configured comment markers.
+// When several markers match, the longest one wins so that e.g. a custom
+// "<!-- e2e:end-step" is not mistaken for "<!-- e2e:end".
+// It returns the marker kind and the name following the marker, with any
+// trailing comment closer removed.
+func matchMarker(line string, tagCfg *config.TagConfig) (markerKind, string) {
+	kind := markerNone
+	matched := ""
+	candidates := []struct {
+		kind    markerKind
+		markers []string
+	}{
+		{markerTestStart, tagCfg.TestStart.CommentMarkers},
+		{markerTestEnd, tagCfg.TestEnd.CommentMarkers},
+		{markerStepStart, tagCfg.StepStart.CommentMarkers},
+		{markerStepEnd, tagCfg.StepEnd.CommentMarkers},
+	}
+	for _, c := range candidates {
+		for _, m := range c.markers {
+			if m != "" && strings.HasPrefix(line, m) && len(m) > len(matched) {
+				kind = c.kind
+				matched = m
+			}
+		}
+	}
+	if kind == markerNone {
+		return markerNone, ""
+	}
+
+	name := strings.TrimSpace(strings.TrimPrefix(line, matched))
+	for _, closer := range commentClosers {
+		name = strings.TrimSpace(strings.TrimSuffix(name, closer))
+	}
+	return kind, name
+}
+
+// tagSet builds a lookup set from the configured step and output tags.
+func tagSet(tagCfg *config.TagConfig) map[string]bool {
+	set := make(map[string]bool, len(tagCfg.StepTags)+len(tagCfg.OutputTags))
+	for _, t := range tagCfg.StepTags {
+		set[t] = true
+	}
+	for _, t := range tagCfg.OutputTags {
+		set[t] = true
+	}
+	return set
+}
+
+// unquote removes one pair of matching surrounding quotes from an attribute
+// value, keeping quotes inside it (e.g. '.status.phase == "Running"').
+func unquote(val string) string {
+	if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+		return val[1 : len(val)-1]
+	}
+	return val
+}
+
+// parseAnnotation parses the body of a step annotation comment such as
+// `go-e2e-step name="Deploy" timeout=60s`, which tags the ordinary code block
+// that follows it. It returns the step tag and the annotation attributes, or
+// ok=false when the first token is not a configured step tag.
+func parseAnnotation(body string, tags map[string]bool) (tag string, attrs map[string]string, ok bool) {
+	parts := parseInfoString(strings.NewReplacer("\r", " ", "\n", " ").Replace(body))
+	tag = parts["_tag"]
+	if !tags[tag] {
+		return "", nil, false
+	}
+	delete(parts, "_tag")
+	return tag, parts, true
+}
+
+// applyTestAttributes resolves the test file a block belongs to from the
+// TestStart / TestEnd attribute keys on its fence (e.g. init="Istio install"
+// and end=true). Attributes take precedence over comment markers:
+//   - a start attribute opens a new test at this block, implicitly closing any
+//     test opened earlier by a comment marker or attribute;
+//   - an end attribute keeps the block in the currently open test and closes
+//     that test after the block.
+//
+// It returns the test file for the block and the test file that stays open
+// for subsequent blocks. An end attribute with no open test, or naming a test
+// other than the open one, is reported as an error message.
+func applyTestAttributes(attrs map[string]string, current string, tagCfg *config.TagConfig) (blockTest, next string, errMsg string) {
+	blockTest = current
+	if key := tagCfg.TestStart.AttributeKey; key != "" {
+		if name, ok := attrs[key]; ok && name != "" {
+			blockTest = name
+		}
+	}
+	next = blockTest
+
+	key := tagCfg.TestEnd.AttributeKey
+	if key == "" {
+		return blockTest, next, ""
+	}
+	val, ok := attrs[key]
+	if !ok || val == "false" || val == "no" {
+		return blockTest, next, ""
+	}
+	if blockTest == "" {
+		return "", "", fmt.Sprintf("%s=%s closes a test but no test is open", key, val)
+	}
+	if val != "true" && val != "yes" && val != "" && val != blockTest {
+		return "", "", fmt.Sprintf("%s=%q does not match the open test %q", key, val, blockTest)
+	}
+	return blockTest, "", ""
+}
+
+// extractFrontMatter parses a leading YAML front matter block delimited by
+// "---" lines into metadata. List values are joined with commas so they fit
+// ParsedDocument.Metadata. The returned content has the front matter lines
+// blanked out, which keeps line numbers of the remaining document intact.
+func extractFrontMatter(filePath string, content []byte) (map[string]string, []byte, error) {
+	lines := bytes.Split(content, []byte("\n"))
+	if len(lines) == 0 || string(bytes.TrimSpace(lines[0])) != "---" {
+		return nil, content, nil
+	}
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		if l := string(bytes.TrimSpace(lines[i])); l == "---" || l == "..." {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return nil, content, nil
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(bytes.Join(lines[1:end], []byte("\n")), &raw); err != nil {
+		return nil, nil, domain.NewErrorWithSuggestion("parse", filePath, 1,
+			"failed to parse YAML front matter",
+			"check the YAML syntax between the leading --- lines",
+			err)
+	}
+
+	meta := make(map[string]string, len(raw))
+	for key, val := range raw {
+		switch v := val.(type) {
+		case nil:
+			meta[key] = ""
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			meta[key] = strings.Join(items, ",")
+		case map[string]interface{}:
+			// Nested mappings are not document defaults; ignore them
+		default:
+			meta[key] = fmt.Sprint(v)
+		}
+	}
+
+	blanked := make([][]byte, len(lines))
+	copy(blanked, lines)
+	for i := 0; i <= end; i++ {
+		blanked[i] = nil
+	}
+	return meta, bytes.Join(blanked, []byte("\n")), nil
+}
@@ -0,0 +1,254 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
+)
+
+// RSTParser parses reStructuredText (Sphinx) documents line by line.
+type RSTParser struct{}
+
+// NewRSTParser creates a new RSTParser.
+func NewRSTParser() *RSTParser {
+	return &RSTParser{}
+}
+
+// SupportedExtensions returns the file extensions this parser handles.
+func (p *RSTParser) SupportedExtensions() []string {
+	return []string{".rst", ".rest"}
+}
+
+var (
+	// Matches .. code-block:: tag, .. code:: tag and .. sourcecode:: tag
+	rstCodeBlockRe = regexp.MustCompile(`^\.\.\s+(?:code-block|code|sourcecode)::\s*(\S*)\s*$`)
+	// Matches a directive option line such as :name: Deploy
+	rstOptionRe = regexp.MustCompile(`^:([\w-]+):\s*(.*)$`)
+)
+
+// rstAdornmentChars are the punctuation characters usable as section adornments.
+const rstAdornmentChars = "=-~^\"'`#*+.:_<>"
+
+// rstHeadingStyle identifies a section adornment style. RST has no fixed
+// heading levels: each new style gets the next level in order of appearance.
+type rstHeadingStyle struct {
+	char     byte
+	overline bool
+}
+
+// Parse parses a reStructuredText document and extracts tagged code blocks and headings.
+func (p *RSTParser) Parse(filePath string, content []byte, tagCfg *config.TagConfig) (*domain.ParsedDocument, error) {
+	lines := strings.Split(string(content), "\n")
+	tags := tagSet(tagCfg)
+
+	parsed := &domain.ParsedDocument{
+		FilePath: filePath,
+		FileType: "rst",
+		Metadata: make(map[string]string),
+	}
+
+	var styles []rstHeadingStyle
+	levelFor := func(style rstHeadingStyle) int {
+		for i, s := range styles {
+			if s == style {
+				return i + 1
+			}
+		}
+		styles = append(styles, style)
+		return len(styles)
+	}
+
+	var currentHeading string
+	var currentTestFile string
+	var currentStepGroup string
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t\r")
+		trimmed := strings.TrimSpace(line)
+
+		// Check for the configured test / step boundary comment markers
+		// (RST comments start with "..")
+		if kind, name := matchMarker(trimmed, tagCfg); kind != markerNone {
+			switch kind {
+			case markerTestStart:
+				currentTestFile = name
+				parsed.Metadata["test-start"] = name
+			case markerTestEnd:
+				currentTestFile = ""
+			case markerStepStart:
+				currentStepGroup = name
+			case markerStepEnd:
+				currentStepGroup = ""
+			}
+			continue
+		}
+
+		// Check for section headings: title with underline, optionally with overline
+		if text, style, consumed, ok := rstHeading(lines, i); ok {
+			parsed.Headings = append(parsed.Headings, domain.Heading{
+				Level: levelFor(style),
+				Text:  text,
+				Line:  i + 1 + boolToInt(style.overline),
+			})
+			currentHeading = text
+			i += consumed - 1
+			continue
+		}
+
+		// Check for .. code-block:: tag directive
+		m := rstCodeBlockRe.FindStringSubmatch(trimmed)
+		if m == nil || !tags[m[1]] {
+			continue
+		}
+		tag := m[1]
+		directiveLine := i + 1
+		directiveIndent := indentOf(lines[i])
+
+		// Directive options follow immediately, indented deeper than the directive
+		attrs := make(map[string]string)
+		i++
+		for ; i < len(lines); i++ {
+			optLine := strings.TrimRight(lines[i], " \t\r")
+			if strings.TrimSpace(optLine) == "" || indentOf(optLine) <= directiveIndent {
+				break
+			}
+			om := rstOptionRe.FindStringSubmatch(strings.TrimSpace(optLine))
+			if om == nil {
+				break
+			}
+			val := unquote(strings.TrimSpace(om[2]))
+			if val == "" {
+				val = "true"
+			}
+			attrs[om[1]] = val
+		}
+
+		// Skip the blank line(s) separating options from content
+		for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+			i++
+		}
+
+		// Content is every line indented deeper than the directive, plus interior blank lines
+		contentStartLine := i + 1
+		var contentLines []string
+		for ; i < len(lines); i++ {
+			l := strings.TrimRight(lines[i], " \t\r")
+			if strings.TrimSpace(l) != "" && indentOf(l) <= directiveIndent {
+				break
+			}
+			contentLines = append(contentLines, l)
+		}
+		i-- // the loop header advances past the last consumed line
+		contentLines = dedent(trimTrailingBlank(contentLines))
+
+		// Directive options may open or close a test file
+		testFile, next, errMsg := applyTestAttributes(attrs, currentTestFile, tagCfg)
+		if errMsg != "" {
+			return nil, domain.NewErrorWithSuggestion("parse", filePath, directiveLine, errMsg,
+				"add a matching test-start marker or init option before this block, or remove the end option",
+				nil)
+		}
+		if testFile != currentTestFile {
+			parsed.Metadata["test-start"] = testFile
+		}
+		currentTestFile = next
+
+		parsed.Blocks = append(parsed.Blocks, domain.CodeBlock{
+			Tag:        tag,
+			Content:    strings.Join(contentLines, "\n"),
+			LineNumber: contentStartLine,
+			Attributes: attrs,
+			Context:    currentHeading,
+			TestFile:   testFile,
+			StepGroup:  currentStepGroup,
+		})
+	}
+
+	return parsed, nil
+}
+
+// rstHeading detects a section title starting at line i. It supports both
+// underline-only titles and titles with a matching overline. It returns the
+// title text, its adornment style and the number of lines consumed.
+func rstHeading(lines []string, i int) (string, rstHeadingStyle, int, bool) {
+	at := func(n int) string {
+		if n < len(lines) {
+			return strings.TrimRight(lines[n], " \t\r")
+		}
+		return ""
+	}
+
+	// Overline + title + underline
+	if over := at(i); isAdornment(over) {
+		title := strings.TrimSpace(at(i + 1))
+		under := at(i + 2)
+		if title != "" && under == over {
+			return title, rstHeadingStyle{char: over[0], overline: true}, 3, true
+		}
+		return "", rstHeadingStyle{}, 0, false
+	}
+
+	// Title + underline: the title must not be indented and the
+	// underline must be at least as long as the title.
+	title := at(i)
+	under := at(i + 1)
+	if strings.TrimSpace(title) == "" || indentOf(title) > 0 {
+		return "", rstHeadingStyle{}, 0, false
+	}
+	if !isAdornment(under) || len(under) < len(title) {
+		return "", rstHeadingStyle{}, 0, false
+	}
+	return strings.TrimSpace(title), rstHeadingStyle{char: under[0]}, 2, true
+}
+
+// isAdornment reports whether a line is a section adornment: at least two
+// repetitions of a single punctuation character.
+func isAdornment(line string) bool {
+	if len(line) < 2 || !strings.ContainsRune(rstAdornmentChars, rune(line[0])) {
+		return false
+	}
+	return strings.Count(line, line[:1]) == len(line)
+}
+
+// indentOf returns the number of leading spaces or tabs in a line.
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// dedent removes the common leading indentation from non-blank lines.
+func dedent(lines []string) []string {
+	minIndent := -1
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if n := indentOf(l); minIndent < 0 || n < minIndent {
+			minIndent = n
+		}
+	}
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		if strings.TrimSpace(l) != "" {
+			out[i] = l[minIndent:]
+		}
+	}
+	return out
+}
+
+// trimTrailingBlank drops blank lines from the end of a slice of lines.
+func trimTrailingBlank(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// boolToInt converts a bool to 0 or 1.
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package parser_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/config"
+	"github.com/fjglira/GoE2E-DocSyncer/internal/parser"
+)
+
+var _ = Describe("RSTParser", func() {
+	var (
+		p      *parser.RSTParser
+		tagCfg config.TagConfig
+	)
+
+	BeforeEach(func() {
+		p = parser.NewRSTParser()
+		tagCfg = config.DefaultConfig().Tags
+	})
+
+	Describe("SupportedExtensions", func() {
+		It("should support .rst and .rest", func() {
+			exts := p.SupportedExtensions()
+			Expect(exts).To(ContainElements(".rst", ".rest"))
+		})
+	})
+
+	Describe("Parse sample.rst", func() {
+		var content []byte
+
+		BeforeEach(func() {
+			var err error
+			content, err = os.ReadFile(filepath.Join("..", "..", "testdata", "rst", "sample.rst"))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should extract 3 code blocks", func() {
+			doc, err := p.Parse("sample.rst", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks).To(HaveLen(3))
+			Expect(doc.FileType).To(Equal("rst"))
+		})
+
+		It("should map directive options to attributes", func() {
+			doc, err := p.Parse("sample.rst", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks[0].Attributes["name"]).To(Equal("Create namespace"))
+			Expect(doc.Blocks[0].Attributes["timeout"]).To(Equal("30s"))
+			Expect(doc.Blocks[1].Attributes["timeout"]).To(Equal("5m"))
+			Expect(doc.Blocks[2].Attributes["name"]).To(Equal("Delete namespace"))
+		})
+
+		It("should dedent block content and keep interior blank lines", func() {
+			doc, err := p.Parse("sample.rst", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks[0].Content).To(Equal("kubectl create namespace istio-system"))
+			Expect(doc.Blocks[0].LineNumber).To(Equal(18))
+			Expect(doc.Blocks[1].Content).To(Equal("istioctl install -y \\\n  --set profile=demo\n\nkubectl -n istio-system get pods"))
+		})
+
+		It("should extract underline-style headings with levels in order of appearance", func() {
+			doc, err := p.Parse("sample.rst", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Headings).To(HaveLen(5))
+			Expect(doc.Headings[0].Text).To(Equal("Istio Install Guide"))
+			Expect(doc.Headings[0].Level).To(Equal(1))
+			Expect(doc.Headings[0].Line).To(Equal(2))
+			Expect(doc.Headings[1].Text).To(Equal("Prerequisites"))
+			Expect(doc.Headings[1].Level).To(Equal(2))
+			Expect(doc.Headings[3].Text).To(Equal("Install the control plane"))
+			Expect(doc.Headings[3].Level).To(Equal(3))
+		})
+
+		It("should set context from nearest heading", func() {
+			doc, err := p.Parse("sample.rst", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks[0].Context).To(Equal("Prerequisites"))
+			Expect(doc.Blocks[1].Context).To(Equal("Install the control plane"))
+			Expect(doc.Blocks[2].Context).To(Equal("Cleanup"))
+		})
+
+		It("should assign TestFile from test-start comments", func() {
+			doc, err := p.Parse("sample.rst", content, &tagCfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(doc.Blocks[0].TestFile).To(Equal("Istio install"))
+			Expect(doc.Blocks[1].TestFile).To(Equal("Istio install"))
+			Expect(doc.Blocks[2].TestFile).To(BeEmpty())
+			Expect(doc.Metadata["test-start"]).To(Equal("Istio install"))
+		})
+	})
+
+	It("should strip one pair of matching quotes from option values, like the other parsers", func() {
+		content := []byte(".. code-block:: go-e2e-step\n   :expect-jsonpath: '{.a}=\"x\"'\n   :name: \"Get a\"\n\n   kubectl get cm a -o json\n")
+		doc, err := p.Parse("quotes.rst", content, &tagCfg)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(doc.Blocks).To(HaveLen(1))
+		Expect(doc.Blocks[0].Attributes["expect-jsonpath"]).To(Equal(`{.a}="x"`))
+		Expect(doc.Blocks[0].Attributes["name"]).To(Equal("Get a"))
+	})
+})
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"go/format"
+	"go/scanner"
+	"go/token"
 	"os"
 	"path/filepath"
 	"strings"
@@ -26,8 +28,10 @@ type TemplateEngine interface {
 
 // testCase represents a single It() block within a Describe.
 type testCase struct {
-	TestName string
-	Steps    []domain.TestStep
+	TestName    string
+	Steps       []domain.TestStep
+	Skip        string
+	SessionCode string
 }
 
 // templateData is the struct passed to templates.
@@ -41,8 +45,90 @@ type templateData struct {
 	TestName      string
 	Steps         []domain.TestStep
 	Tests         []testCase
-	NeedsContext  bool
-	Labels        []string
+	importNeeds
+	Labels         []string
+	Skip           string
+	SessionCode    string
+	SetupSteps     []domain.TestStep
+	CleanupSteps   []domain.TestStep
+	BeforeAllSteps []domain.TestStep
+	AfterAllSteps  []domain.TestStep
+}
+
+// importNeeds records which optional packages the generated step code uses,
+// so templates can import them conditionally.
+type importNeeds struct {
+	NeedsContext bool // context: timeouts
+	NeedsTime    bool // time: timeouts, node timeouts and retry sleeps
+	NeedsSyscall bool // syscall: process groups killed on timeout
+	NeedsBufio   bool // bufio: persistent shell sessions
+	NeedsStrings bool // strings: output assertions
+	NeedsJSON    bool // encoding/json: expect-json / expect-jsonpath
+	NeedsYAML    bool // gopkg.in/yaml.v3: expect-yaml
+	NeedsOS      bool // os: step environment and stdin files
+	NeedsRegexp  bool // regexp: capture-regex
+	NeedsFmt     bool // fmt: capture-jsonpath and background readiness
+	NeedsNet     bool // net: background ready-when port checks
+	NeedsGbytes  bool // gomega/gbytes: background process output
+}
+
+// detectImports inspects the generated code of a spec (session setup and
+// steps) for optional package usage. Only package selectors of the Go code
+// count: command text in string literals, such as "go doc fmt.Println", does not.
+func detectImports(spec domain.TestSpec, needs *importNeeds) {
+	codes := []string{spec.SessionCode}
+	for _, steps := range [][]domain.TestStep{spec.Steps, spec.SetupSteps, spec.CleanupSteps, spec.BeforeAllSteps, spec.AfterAllSteps} {
+		for _, step := range steps {
+			codes = append(codes, step.GoCode)
+			if step.MaxDuration > 0 {
+				needs.NeedsTime = true // NodeTimeout
+			}
+		}
+	}
+	for _, code := range codes {
+		uses := packageSelectors(code)
+		needs.NeedsContext = needs.NeedsContext || uses["context"]
+		needs.NeedsTime = needs.NeedsTime || uses["time"] || uses["context.WithTimeout"]
+		needs.NeedsSyscall = needs.NeedsSyscall || uses["syscall"]
+		needs.NeedsBufio = needs.NeedsBufio || uses["bufio"]
+		needs.NeedsStrings = needs.NeedsStrings || uses["strings"]
+		needs.NeedsJSON = needs.NeedsJSON || uses["json"]
+		needs.NeedsYAML = needs.NeedsYAML || uses["yaml"]
+		needs.NeedsOS = needs.NeedsOS || uses["os"]
+		needs.NeedsRegexp = needs.NeedsRegexp || uses["regexp"]
+		needs.NeedsFmt = needs.NeedsFmt || uses["fmt"]
+		needs.NeedsNet = needs.NeedsNet || uses["net"]
+		needs.NeedsGbytes = needs.NeedsGbytes || uses["gbytes"]
+	}
+}
+
+// packageSelectors returns the pkg.Name selectors of code, keyed both as
+// "pkg" and "pkg.Name". The code is tokenized, not parsed, so statement lists
+// work, and string literals and comments are skipped. A selector following a
+// dot, as in cmd.Process.Pid, is a field and not a package use.
+func packageSelectors(code string) map[string]bool {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	src := []byte(code)
+	s.Init(fset.AddFile("", fset.Base(), len(src)), src, nil, 0)
+
+	type scanned struct {
+		tok token.Token
+		lit string
+	}
+	uses := make(map[string]bool)
+	var last [3]scanned // the three previous tokens, most recent first
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return uses
+		}
+		if tok == token.IDENT && last[0].tok == token.PERIOD && last[1].tok == token.IDENT && last[2].tok != token.PERIOD {
+			uses[last[1].lit] = true
+			uses[last[1].lit+"."+lit] = true
+		}
+		last = [3]scanned{{tok, lit}, last[0], last[1]}
+	}
 }
 
 // DefaultEngine implements TemplateEngine.
@@ -158,26 +244,27 @@ func (e *DefaultEngine) Render(spec domain.TestSpec, packageName string) (string
 			nil)
 	}
 
-	// Determine if any step uses context/timeout or time.Sleep (retry)
-	needsContext := false
-	for _, step := range spec.Steps {
-		if strings.Contains(step.GoCode, "context.WithTimeout") || strings.Contains(step.GoCode, "time.Sleep") {
-			needsContext = true
-			break
-		}
-	}
+	// Determine which optional packages the steps use (context/timeout, retry sleeps, assertions)
+	var needs importNeeds
+	detectImports(spec, &needs)
 
 	data := templateData{
-		PackageName:   packageName,
-		BuildTag:      e.buildTag,
-		SourceFile:    spec.SourceFile,
-		SourceType:    spec.SourceType,
-		DescribeBlock: spec.DescribeBlock,
-		ContextBlock:  spec.ContextBlock,
-		TestName:      spec.TestName,
-		Steps:         spec.Steps,
-		NeedsContext:  needsContext,
-		Labels:        spec.Labels,
+		PackageName:    packageName,
+		BuildTag:       e.buildTag,
+		SourceFile:     spec.SourceFile,
+		SourceType:     spec.SourceType,
+		DescribeBlock:  spec.DescribeBlock,
+		ContextBlock:   spec.ContextBlock,
+		TestName:       spec.TestName,
+		Steps:          spec.Steps,
+		importNeeds:    needs,
+		Labels:         spec.Labels,
+		Skip:           spec.Skip,
+		SessionCode:    spec.SessionCode,
+		SetupSteps:     spec.SetupSteps,
+		CleanupSteps:   spec.CleanupSteps,
+		BeforeAllSteps: spec.BeforeAllSteps,
+		AfterAllSteps:  spec.AfterAllSteps,
 	}
 
 	var buf bytes.Buffer
@@ -225,33 +312,37 @@ func (e *DefaultEngine) RenderMulti(specs []domain.TestSpec, packageName string)
 			nil)
 	}
 
-	// Build test cases and check for context usage or time.Sleep (retry)
-	needsContext := false
+	// Build test cases and check which optional packages the steps use
+	var needs importNeeds
 	var tests []testCase
 	for _, spec := range specs {
-		for _, step := range spec.Steps {
-			if strings.Contains(step.GoCode, "context.WithTimeout") || strings.Contains(step.GoCode, "time.Sleep") {
-				needsContext = true
-			}
-		}
+		detectImports(spec, &needs)
 		tests = append(tests, testCase{
-			TestName: spec.TestName,
-			Steps:    spec.Steps,
+			TestName:    spec.TestName,
+			Steps:       spec.Steps,
+			Skip:        spec.Skip,
+			SessionCode: spec.SessionCode,
 		})
 	}
 
 	data := templateData{
-		PackageName:   packageName,
-		BuildTag:      e.buildTag,
-		SourceFile:    first.SourceFile,
-		SourceType:    first.SourceType,
-		DescribeBlock: first.DescribeBlock,
-		ContextBlock:  first.ContextBlock,
-		TestName:      first.TestName,
-		Steps:         first.Steps,
-		Tests:         tests,
-		NeedsContext:  needsContext,
-		Labels:        first.Labels,
+		PackageName:    packageName,
+		BuildTag:       e.buildTag,
+		SourceFile:     first.SourceFile,
+		SourceType:     first.SourceType,
+		DescribeBlock:  first.DescribeBlock,
+		ContextBlock:   first.ContextBlock,
+		TestName:       first.TestName,
+		Steps:          first.Steps,
+		Tests:          tests,
+		importNeeds:    needs,
+		Labels:         first.Labels,
+		Skip:           first.Skip,
+		SessionCode:    first.SessionCode,
+		SetupSteps:     first.SetupSteps,
+		CleanupSteps:   first.CleanupSteps,
+		BeforeAllSteps: first.BeforeAllSteps,
+		AfterAllSteps:  first.AfterAllSteps,
 	}
 
 	var buf bytes.Buffer
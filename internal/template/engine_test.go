@@ -3,6 +3,7 @@ package template_test
 import (
 	"path/filepath"
 	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -70,6 +71,45 @@ var _ = Describe("TemplateEngine", func() {
 			Expect(result).To(ContainSubstring(`"time"`))
 		})
 
+		It("should import strings when output assertions use it", func() {
+			spec := domain.TestSpec{
+				SourceFile:    "test.md",
+				SourceType:    "markdown",
+				TestName:      "Output test",
+				DescribeBlock: "Output Feature",
+				Steps: []domain.TestStep{
+					{
+						Name:   "Check output",
+						GoCode: `cmd := exec.Command("echo", "hello")` + "\n" + `output, err := cmd.CombinedOutput()` + "\n" + `Expect(err).ToNot(HaveOccurred(), string(output))` + "\n" + `Expect(strings.TrimSpace(string(output))).To(Equal("hello"))`,
+					},
+				},
+			}
+
+			result, err := engine.Render(spec, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(ContainSubstring(`"strings"`))
+			Expect(result).ToNot(ContainSubstring(`"context"`))
+		})
+
+		It("should not import strings for a command that mentions it", func() {
+			spec := domain.TestSpec{
+				SourceFile:    "test.md",
+				SourceType:    "markdown",
+				TestName:      "Grep test",
+				DescribeBlock: "Grep Feature",
+				Steps: []domain.TestStep{
+					{
+						Name:   "Find calls",
+						GoCode: `cmd := exec.Command("grep", "strings.TrimSpace", "main.go") // strings.Fields too` + "\n" + `output, err := cmd.CombinedOutput()` + "\n" + `Expect(err).ToNot(HaveOccurred(), string(output))`,
+					},
+				},
+			}
+
+			result, err := engine.Render(spec, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).ToNot(ContainSubstring(`"strings"` + "\n"))
+		})
+
 		It("should render context block when present", func() {
 			spec := domain.TestSpec{
 				SourceFile:    "test.md",
@@ -109,6 +149,25 @@ var _ = Describe("TemplateEngine", func() {
 			// go/format output should not have excessive whitespace
 			Expect(strings.Contains(result, "\t\t\t\t\t\t")).To(BeFalse())
 		})
+
+		It("should quote step names, which come from block titles", func() {
+			spec := domain.TestSpec{
+				SourceFile:    "test.adoc",
+				SourceType:    "asciidoc",
+				TestName:      "Titles",
+				DescribeBlock: "My Feature",
+				Steps: []domain.TestStep{
+					{
+						Name:   `Run "make" in C:\src`,
+						GoCode: `cmd := exec.Command("make")` + "\n" + `output, err := cmd.CombinedOutput()` + "\n" + `Expect(err).ToNot(HaveOccurred(), string(output))`,
+					},
+				},
+			}
+
+			result, err := engine.Render(spec, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(ContainSubstring(`By("Run \"make\" in C:\\src")`))
+		})
 	})
 
 	Describe("RenderMulti", func() {
@@ -242,6 +301,48 @@ var _ = Describe("TemplateEngine", func() {
 			Expect(result).To(ContainSubstring(`Label("documentation", "Redis deployment E2E")`))
 		})
 
+		It("should escape quotes and backslashes in labels", func() {
+			spec := domain.TestSpec{
+				SourceFile:    "test.md",
+				SourceType:    "markdown",
+				TestName:      "My test",
+				DescribeBlock: "Paths",
+				Labels:        []string{`team "core"`, `C:\tmp`},
+				Steps: []domain.TestStep{
+					{
+						Name:   "Step 1",
+						GoCode: `cmd := exec.Command("echo", "hello")` + "\n" + `output, err := cmd.CombinedOutput()` + "\n" + `Expect(err).ToNot(HaveOccurred(), string(output))`,
+					},
+				},
+			}
+
+			result, err := engine.Render(spec, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(ContainSubstring(`Label("team \"core\"", "C:\\tmp")`))
+		})
+
+		It("should escape quotes and backslashes in Describe, Context and It names", func() {
+			spec := domain.TestSpec{
+				SourceFile:    "test.md",
+				SourceType:    "markdown",
+				TestName:      `Build in C:\src`,
+				DescribeBlock: `Guide "quoted"`,
+				ContextBlock:  `On "kind" \ local`,
+				Steps: []domain.TestStep{
+					{
+						Name:   "Step 1",
+						GoCode: `cmd := exec.Command("echo", "hello")` + "\n" + `output, err := cmd.CombinedOutput()` + "\n" + `Expect(err).ToNot(HaveOccurred(), string(output))`,
+					},
+				},
+			}
+
+			result, err := engine.Render(spec, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(ContainSubstring(`Describe("Guide \"quoted\"", func() {`))
+			Expect(result).To(ContainSubstring(`Context("On \"kind\" \\ local", func() {`))
+			Expect(result).To(ContainSubstring(`It("Build in C:\\src", func(ctx SpecContext) {`))
+		})
+
 		It("should not render Label() when labels are empty", func() {
 			spec := domain.TestSpec{
 				SourceFile:    "test.md",
@@ -335,4 +436,267 @@ var _ = Describe("TemplateEngine", func() {
 			Expect(result).To(ContainSubstring(`It("Embedded test"`))
 		})
 	})
+
+	Describe("Skip rendering", func() {
+		It("should render Skip() with the reason when the spec is skipped", func() {
+			spec := domain.TestSpec{
+				SourceFile:    "test.md",
+				SourceType:    "markdown",
+				TestName:      "Skipped test",
+				DescribeBlock: "Feature",
+				Skip:          "requires a GPU node",
+				Steps: []domain.TestStep{
+					{
+						Name:   "Step",
+						GoCode: `cmd := exec.Command("echo")` + "\n" + `output, err := cmd.CombinedOutput()` + "\n" + `Expect(err).ToNot(HaveOccurred(), string(output))`,
+					},
+				},
+			}
+
+			result, err := engine.Render(spec, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(ContainSubstring(`Skip("requires a GPU node")`))
+		})
+
+		It("should skip before any setup command runs or cleanup is registered", func() {
+			step := func(name string) domain.TestStep {
+				return domain.TestStep{Name: name, GoCode: `cmd := exec.Command("` + name + `")` + "\n" + `output, err := cmd.CombinedOutput()` + "\n" + `Expect(err).ToNot(HaveOccurred(), string(output))`}
+			}
+			spec := domain.TestSpec{
+				SourceFile:     "test.md",
+				SourceType:     "markdown",
+				TestName:       "Skipped test",
+				DescribeBlock:  "Feature",
+				Skip:           "requires a GPU node",
+				BeforeAllSteps: []domain.TestStep{step("install")},
+				AfterAllSteps:  []domain.TestStep{step("uninstall")},
+				SetupSteps:     []domain.TestStep{step("create")},
+				CleanupSteps:   []domain.TestStep{step("delete")},
+				Steps:          []domain.TestStep{step("check")},
+			}
+
+			result, err := engine.Render(spec, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(MatchRegexp(`BeforeAll\(func\(ctx SpecContext\) \{\s*Skip\("requires a GPU node"\)\s*DeferCleanup`))
+			Expect(result).To(MatchRegexp(`BeforeEach\(func\(ctx SpecContext\) \{\s*Skip\("requires a GPU node"\)\s*DeferCleanup`))
+			Expect(strings.Count(result, `Skip("requires a GPU node")`)).To(Equal(3))
+		})
+
+		It("should not render Skip() for regular specs", func() {
+			spec := domain.TestSpec{
+				SourceFile:    "test.md",
+				SourceType:    "markdown",
+				TestName:      "Regular test",
+				DescribeBlock: "Feature",
+				Steps: []domain.TestStep{
+					{
+						Name:   "Step",
+						GoCode: `cmd := exec.Command("echo")` + "\n" + `output, err := cmd.CombinedOutput()` + "\n" + `Expect(err).ToNot(HaveOccurred(), string(output))`,
+					},
+				},
+			}
+
+			result, err := engine.Render(spec, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).ToNot(ContainSubstring("Skip("))
+		})
+	})
+
+	Describe("Captured variables", func() {
+		It("should declare vars and import os and regexp when steps capture output", func() {
+			spec := domain.TestSpec{
+				SourceFile:    "test.md",
+				SourceType:    "markdown",
+				TestName:      "Capture test",
+				DescribeBlock: "Feature",
+				Steps: []domain.TestStep{
+					{
+						Name:       "Find pod",
+						CaptureVar: "POD",
+						GoCode:     `cmd := exec.Command("echo", "pod/web")` + "\n" + `output, err := cmd.CombinedOutput()` + "\n" + `Expect(err).ToNot(HaveOccurred(), string(output))` + "\n" + `m := regexp.MustCompile("pod/(\\S+)").FindStringSubmatch(string(output))` + "\n" + `vars["POD"] = strings.TrimSpace(m[1])`,
+					},
+					{
+						Name:     "Use pod",
+						UsesVars: []string{"POD"},
+						GoCode:   `cmd := exec.Command("bash", "-c", "echo ${POD}")` + "\n" + `cmd.Env = append(os.Environ(), "POD="+vars["POD"])` + "\n" + `output, err := cmd.CombinedOutput()` + "\n" + `Expect(err).ToNot(HaveOccurred(), string(output))`,
+					},
+				},
+			}
+
+			result, err := engine.RenderMulti([]domain.TestSpec{spec}, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(ContainSubstring(`vars := map[string]string{}`))
+			Expect(result).To(ContainSubstring(`"os"`))
+			Expect(result).To(ContainSubstring(`"regexp"`))
+			Expect(result).To(ContainSubstring(`"strings"`))
+		})
+
+		It("should not declare vars when no step captures output", func() {
+			spec := domain.TestSpec{
+				SourceFile:    "test.md",
+				SourceType:    "markdown",
+				TestName:      "Plain test",
+				DescribeBlock: "Feature",
+				Steps: []domain.TestStep{
+					{
+						Name:   "Step",
+						GoCode: `cmd := exec.Command("echo")` + "\n" + `output, err := cmd.CombinedOutput()` + "\n" + `Expect(err).ToNot(HaveOccurred(), string(output))`,
+					},
+				},
+			}
+
+			result, err := engine.Render(spec, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).ToNot(ContainSubstring("vars :="))
+			Expect(result).ToNot(ContainSubstring(`"os"`))
+		})
+
+		It("should not import fmt, regexp or os for commands that mention them", func() {
+			spec := domain.TestSpec{
+				SourceFile:    "test.md",
+				SourceType:    "markdown",
+				TestName:      "Docs test",
+				DescribeBlock: "Feature",
+				Steps: []domain.TestStep{
+					{
+						Name:   "Docs",
+						GoCode: `cmd := exec.Command("sh", "-c", "go doc fmt.Println && go doc regexp.MustCompile && go doc os.Open")` + "\n" + `output, err := cmd.CombinedOutput()` + "\n" + `Expect(err).ToNot(HaveOccurred(), string(output))`,
+					},
+				},
+			}
+
+			result, err := engine.Render(spec, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			for _, pkg := range []string{`"fmt"`, `"regexp"`, `"os"`} {
+				Expect(result).ToNot(ContainSubstring(pkg))
+			}
+		})
+	})
+
+	Describe("Persistent shell sessions", func() {
+		It("should render the session setup before the steps and import its packages", func() {
+			spec := domain.TestSpec{
+				SourceFile:    "test.md",
+				SourceType:    "markdown",
+				TestName:      "Session test",
+				DescribeBlock: "Feature",
+				SessionCode:   `shellReader := bufio.NewReader(strings.NewReader(""))` + "\n" + `runInShell := func(command string, env []string, timeout time.Duration) ([]byte, int, error) { _ = shellReader; return nil, 0, fmt.Errorf("unused") }`,
+				Steps: []domain.TestStep{
+					{
+						Name:      "Step",
+						InSession: true,
+						GoCode:    `output, exitCode, err := runInShell("cd /tmp", nil, 0)` + "\n" + `Expect(err).ToNot(HaveOccurred(), string(output))` + "\n" + `Expect(exitCode).To(Equal(0), string(output))`,
+					},
+				},
+			}
+
+			result, err := engine.RenderMulti([]domain.TestSpec{spec}, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.Index(result, "runInShell := func")).To(BeNumerically("<", strings.Index(result, `By("Step")`)))
+			for _, pkg := range []string{`"bufio"`, `"fmt"`, `"strings"`, `"time"`} {
+				Expect(result).To(ContainSubstring(pkg))
+			}
+			Expect(result).ToNot(ContainSubstring(`"context"`))
+		})
+	})
+
+	Describe("Setup and cleanup phases", func() {
+		step := func(name string) domain.TestStep {
+			return domain.TestStep{
+				Name:   name,
+				GoCode: `cmd := exec.Command("echo", "` + name + `")` + "\n" + `output, err := cmd.CombinedOutput()` + "\n" + `Expect(err).ToNot(HaveOccurred(), string(output))`,
+			}
+		}
+
+		It("should render setup in BeforeEach and cleanup as DeferCleanup in document order", func() {
+			spec := domain.TestSpec{
+				SourceFile:    "test.md",
+				SourceType:    "markdown",
+				TestName:      "Phase test",
+				DescribeBlock: "Feature",
+				Steps:         []domain.TestStep{step("run")},
+				SetupSteps:    []domain.TestStep{step("create")},
+				CleanupSteps:  []domain.TestStep{step("delete pods"), step("delete ns")},
+			}
+
+			result, err := engine.RenderMulti([]domain.TestSpec{spec}, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(ContainSubstring("BeforeEach(func(ctx SpecContext) {"))
+			Expect(result).ToNot(ContainSubstring("Ordered"))
+			Expect(strings.Count(result, "DeferCleanup(func(ctx SpecContext) {")).To(Equal(2))
+			// DeferCleanup runs last-registered first, so the last cleanup step is registered first
+			Expect(strings.Index(result, `By("delete ns")`)).To(BeNumerically("<", strings.Index(result, `By("delete pods")`)))
+			Expect(strings.Index(result, `By("delete pods")`)).To(BeNumerically("<", strings.Index(result, `By("create")`)))
+			Expect(strings.Index(result, `By("create")`)).To(BeNumerically("<", strings.Index(result, `It("Phase test"`)))
+		})
+
+		It("should make the Describe Ordered for before-all and after-all steps", func() {
+			spec := domain.TestSpec{
+				SourceFile:     "test.md",
+				SourceType:     "markdown",
+				TestName:       "Phase test",
+				DescribeBlock:  "Feature",
+				Labels:         []string{"smoke"},
+				Steps:          []domain.TestStep{step("run")},
+				BeforeAllSteps: []domain.TestStep{step("install")},
+				AfterAllSteps:  []domain.TestStep{step("uninstall")},
+			}
+
+			result, err := engine.Render(spec, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(ContainSubstring(`Describe("Feature", Ordered, Label("smoke"), func() {`))
+			Expect(result).To(ContainSubstring("BeforeAll(func(ctx SpecContext) {"))
+			Expect(strings.Index(result, `By("uninstall")`)).To(BeNumerically("<", strings.Index(result, `By("install")`)))
+			Expect(result).ToNot(ContainSubstring("BeforeEach"))
+		})
+	})
+
+	Describe("Node timeouts", func() {
+		step := func(name string, max time.Duration) domain.TestStep {
+			return domain.TestStep{
+				Name:        name,
+				MaxDuration: max,
+				GoCode: `cmd := exec.CommandContext(ctx, "echo", "` + name + `")` + "\n" +
+					`cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}` + "\n" +
+					`output, err := cmd.CombinedOutput()` + "\n" + `Expect(err).ToNot(HaveOccurred(), string(output))`,
+			}
+		}
+
+		It("should pass the SpecContext and a NodeTimeout covering all steps of each node", func() {
+			spec := domain.TestSpec{
+				SourceFile:    "test.md",
+				SourceType:    "markdown",
+				TestName:      "Timed test",
+				DescribeBlock: "Feature",
+				Steps:         []domain.TestStep{step("a", 30*time.Second), step("b", 90*time.Second)},
+				SetupSteps:    []domain.TestStep{step("setup", 1500*time.Millisecond)},
+				CleanupSteps:  []domain.TestStep{step("cleanup", 10*time.Second)},
+			}
+
+			result, err := engine.Render(spec, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(ContainSubstring(`It("Timed test", func(ctx SpecContext) {`))
+			Expect(result).To(ContainSubstring("}, NodeTimeout(3*time.Minute))"))
+			Expect(result).To(ContainSubstring("}, NodeTimeout(61500*time.Millisecond))"))
+			Expect(result).To(ContainSubstring("}, NodeTimeout(70*time.Second))"))
+			for _, pkg := range []string{`"syscall"`, `"time"`} {
+				Expect(result).To(ContainSubstring(pkg))
+			}
+		})
+
+		It("should omit the NodeTimeout when a step is unbounded", func() {
+			spec := domain.TestSpec{
+				SourceFile:    "test.md",
+				SourceType:    "markdown",
+				TestName:      "Unbounded test",
+				DescribeBlock: "Feature",
+				Steps:         []domain.TestStep{step("a", 30*time.Second), step("wait", 0)},
+			}
+
+			result, err := engine.Render(spec, "e2e_test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(ContainSubstring(`It("Unbounded test", func(ctx SpecContext) {`))
+			Expect(result).ToNot(ContainSubstring("NodeTimeout"))
+		})
+	})
 })
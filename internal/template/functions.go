@@ -1,8 +1,12 @@
 package template
 
 import (
+	"fmt"
 	"strings"
 	"text/template"
+	"time"
+
+	"github.com/fjglira/GoE2E-DocSyncer/internal/domain"
 )
 
 // CustomFuncMap returns the custom template functions available in templates.
@@ -34,12 +38,61 @@ func CustomFuncMap() template.FuncMap {
 			// This is a helper for templates; actual parsing happens at runtime
 			return s
 		},
+		"capturesVars": func(steps []domain.TestStep) bool {
+			for _, s := range steps {
+				if s.CaptureVar != "" {
+					return true
+				}
+			}
+			return false
+		},
+		// reverseSteps returns steps last to first, e.g. to register
+		// DeferCleanup callbacks that then run in document order.
+		"reverseSteps": func(steps []domain.TestStep) []domain.TestStep {
+			reversed := make([]domain.TestStep, len(steps))
+			for i, s := range steps {
+				reversed[len(steps)-1-i] = s
+			}
+			return reversed
+		},
+		"stepList": func(steps ...domain.TestStep) []domain.TestStep {
+			return steps
+		},
+		"nodeTimeout": nodeTimeout,
 		"labelArgs": func(labels []string) string {
 			quoted := make([]string, len(labels))
 			for i, l := range labels {
-				quoted[i] = `"` + l + `"`
+				quoted[i] = fmt.Sprintf("%q", l)
 			}
 			return strings.Join(quoted, ", ")
 		},
 	}
 }
+
+// nodeTimeoutSlack is added to the running time of a node's steps, so their own
+// timeouts fire first and the node timeout only catches what they cannot bound.
+const nodeTimeoutSlack = time.Minute
+
+// nodeTimeout returns the Go expression of the NodeTimeout for a Ginkgo node
+// running steps: the sum of their longest running times plus a slack. It
+// returns "" when a step is unbounded, so the node gets no NodeTimeout.
+func nodeTimeout(steps []domain.TestStep) string {
+	if len(steps) == 0 {
+		return ""
+	}
+	total := nodeTimeoutSlack
+	for _, s := range steps {
+		if s.MaxDuration <= 0 {
+			return ""
+		}
+		total += s.MaxDuration
+	}
+
+	switch {
+	case total%time.Minute == 0:
+		return fmt.Sprintf("%d * time.Minute", total/time.Minute)
+	case total%time.Second == 0:
+		return fmt.Sprintf("%d * time.Second", total/time.Second)
+	}
+	return fmt.Sprintf("%d * time.Millisecond", total/time.Millisecond)
+}